@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Aggregate 集計カラム
+type Aggregate struct {
+	// Header 集計結果のヘッダ
+	Header string `json:"header" yaml:"header" toml:"header"`
+	// Function 集計関数(count, sum, min, max, avg, countDistinct)
+	Function string `json:"function" yaml:"function" toml:"function"`
+	// Column 集計対象のカラムのヘッダ(countで省略した場合は行数)
+	Column string `json:"column,omitempty" yaml:"column" toml:"column"`
+}
+
+const (
+	AggregateCount         = "count"
+	AggregateSum           = "sum"
+	AggregateMin           = "min"
+	AggregateMax           = "max"
+	AggregateAvg           = "avg"
+	AggregateCountDistinct = "countDistinct"
+)
+
+// maxDecimalPlaces 小数点以下を固定の桁数で出力する上限(float64の有効桁数程度)
+const maxDecimalPlaces = 17
+
+// aggregateRowWriter 行をグループごとに集計し、最後に集計結果を出力
+type aggregateRowWriter struct {
+	writer        rowWriter
+	groupIndexes  []int
+	aggregates    []Aggregate
+	columnIndexes []int
+	groups        map[string]*aggregateGroup
+	order         []*aggregateGroup
+}
+
+type aggregateGroup struct {
+	keys   []*string
+	states []*aggregateState
+}
+
+// aggregateState 集計途中の状態(空の値は集計対象外)
+type aggregateState struct {
+	rows     int
+	count    int
+	sum      float64
+	scale    int
+	min      *string
+	max      *string
+	distinct map[string]struct{}
+}
+
+// isAggregation returns true if the mapping summarizes the rows.
+func (m *Mapping) isAggregation() bool {
+	return len(m.GroupBy) != 0 || len(m.Aggregates) != 0
+}
+
+// outputHeaders returns the headers of the output, which are the group by and the aggregate headers when aggregating.
+func (m *Mapping) outputHeaders() []string {
+
+	var headers []string
+	if !m.isAggregation() {
+		for _, column := range m.Columns {
+			headers = append(headers, column.Header)
+		}
+		return headers
+	}
+
+	headers = append(headers, m.GroupBy...)
+	for _, aggregate := range m.Aggregates {
+		headers = append(headers, aggregate.Header)
+	}
+	return headers
+}
+
+// outputDescriptions returns the descriptions of the output headers. The aggregates have no descriptions.
+func (m *Mapping) outputDescriptions() []string {
+
+	descriptions := []string{}
+	if !m.isAggregation() {
+		for _, column := range m.Columns {
+			descriptions = append(descriptions, column.Description)
+		}
+		return descriptions
+	}
+
+	for _, header := range m.GroupBy {
+		index := slices.IndexFunc(m.Columns, func(column Column) bool { return column.Header == header })
+		descriptions = append(descriptions, m.Columns[index].Description)
+	}
+	for range m.Aggregates {
+		descriptions = append(descriptions, "")
+	}
+	return descriptions
+}
+
+// validateAggregation checks the group by headers and the aggregates.
+func validateAggregation(groupBy []string, aggregates []Aggregate, columns []Column) error {
+
+	hasColumn := func(header string) bool {
+		return slices.ContainsFunc(columns, func(column Column) bool { return column.Header == header })
+	}
+
+	for _, header := range groupBy {
+		if !hasColumn(header) {
+			return fmt.Errorf("groupBy '%s' is not a header of the columns", header)
+		}
+	}
+
+	for i, aggregate := range aggregates {
+		if aggregate.Header == "" {
+			return fmt.Errorf("aggregates[%d]: header is required", i)
+		}
+
+		switch aggregate.Function {
+		case AggregateCount:
+			if aggregate.Column == "" {
+				continue
+			}
+		case AggregateSum, AggregateMin, AggregateMax, AggregateAvg, AggregateCountDistinct:
+			if aggregate.Column == "" {
+				return fmt.Errorf("aggregates[%d]: column is required for %s", i, aggregate.Function)
+			}
+		default:
+			return fmt.Errorf("aggregates[%d]: function must be one of count, sum, min, max, avg, countDistinct", i)
+		}
+
+		if !hasColumn(aggregate.Column) {
+			return fmt.Errorf("aggregates[%d]: column '%s' is not a header of the columns", i, aggregate.Column)
+		}
+	}
+
+	return nil
+}
+
+func newAggregateRowWriter(writer rowWriter, headers []string, groupBy []string, aggregates []Aggregate) *aggregateRowWriter {
+
+	var groupIndexes []int
+	for _, header := range groupBy {
+		groupIndexes = append(groupIndexes, slices.Index(headers, header))
+	}
+
+	var columnIndexes []int
+	for _, aggregate := range aggregates {
+		// countでカラムを省略した場合は-1
+		columnIndexes = append(columnIndexes, slices.Index(headers, aggregate.Column))
+	}
+
+	return &aggregateRowWriter{
+		writer:        writer,
+		groupIndexes:  groupIndexes,
+		aggregates:    aggregates,
+		columnIndexes: columnIndexes,
+		groups:        map[string]*aggregateGroup{},
+	}
+}
+
+func (w *aggregateRowWriter) Write(values []*string) error {
+
+	keys := make([]*string, len(w.groupIndexes))
+	for i, index := range w.groupIndexes {
+		keys[i] = values[index]
+	}
+
+	group := w.group(keys)
+	for i, aggregate := range w.aggregates {
+		var value *string
+		if index := w.columnIndexes[i]; index != -1 {
+			value = values[index]
+		}
+
+		if err := group.states[i].add(aggregate, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *aggregateRowWriter) Flush() error {
+
+	// グループ化しない場合は、行が無くても全体の集計結果を1行出力
+	if len(w.groupIndexes) == 0 && len(w.order) == 0 {
+		w.group(nil)
+	}
+
+	for _, group := range w.order {
+		values := slices.Clone(group.keys)
+		for i, aggregate := range w.aggregates {
+			values = append(values, group.states[i].result(aggregate))
+		}
+
+		if err := w.writer.Write(values); err != nil {
+			return err
+		}
+	}
+
+	return w.writer.Flush()
+}
+
+// group returns the group of the keys, creating it in the order of appearance.
+func (w *aggregateRowWriter) group(keys []*string) *aggregateGroup {
+
+	key := string(encodeRow(keys))
+	if group, found := w.groups[key]; found {
+		return group
+	}
+
+	group := &aggregateGroup{keys: keys}
+	for range w.aggregates {
+		group.states = append(group.states, &aggregateState{})
+	}
+
+	w.groups[key] = group
+	w.order = append(w.order, group)
+	return group
+}
+
+func (s *aggregateState) add(aggregate Aggregate, value *string) error {
+
+	s.rows++
+	if value == nil || *value == "" {
+		return nil
+	}
+	s.count++
+
+	switch aggregate.Function {
+	case AggregateSum, AggregateAvg:
+		number, err := strconv.ParseFloat(strings.TrimSpace(*value), 64)
+		if err != nil {
+			return fmt.Errorf("aggregate '%s': '%s' is not a number", aggregate.Header, *value)
+		}
+		s.sum += number
+		s.scale = max(s.scale, decimalPlaces(*value))
+	case AggregateMin:
+		if s.min == nil || compareValue(value, s.min, true) < 0 {
+			s.min = value
+		}
+	case AggregateMax:
+		if s.max == nil || compareValue(value, s.max, true) > 0 {
+			s.max = value
+		}
+	case AggregateCountDistinct:
+		if s.distinct == nil {
+			s.distinct = map[string]struct{}{}
+		}
+		s.distinct[*value] = struct{}{}
+	}
+
+	return nil
+}
+
+// result returns the aggregated value, or nil if there are no values to aggregate.
+func (s *aggregateState) result(aggregate Aggregate) *string {
+
+	var result string
+	switch aggregate.Function {
+	case AggregateCount:
+		if aggregate.Column == "" {
+			result = strconv.Itoa(s.rows)
+		} else {
+			result = strconv.Itoa(s.count)
+		}
+	case AggregateCountDistinct:
+		result = strconv.Itoa(len(s.distinct))
+	case AggregateSum:
+		if s.count == 0 {
+			return nil
+		}
+		// 浮動小数点の誤差が出ないように、入力の小数点以下の桁数に揃える
+		result = formatDecimal(s.sum, s.scale)
+	case AggregateAvg:
+		if s.count == 0 {
+			return nil
+		}
+		// 入力の小数点以下の桁数より6桁多く丸め、末尾の0は除く
+		result = formatDecimal(s.sum/float64(s.count), s.scale+6)
+		if s.scale+6 <= maxDecimalPlaces {
+			result = strings.TrimRight(strings.TrimRight(result, "0"), ".")
+		}
+	case AggregateMin:
+		return s.min
+	case AggregateMax:
+		return s.max
+	}
+
+	return &result
+}
+
+// formatDecimal formats the value with the decimal places.
+// Beyond the precision of float64, the shortest representation such as '1.5e-20' is used instead.
+func formatDecimal(value float64, places int) string {
+
+	if places > maxDecimalPlaces {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+
+	return strconv.FormatFloat(value, 'f', places, 64)
+}
+
+// decimalPlaces returns the number of digits after the decimal point, taking the exponent into account.
+func decimalPlaces(value string) int {
+
+	mantissa, exponent, _ := strings.Cut(strings.ToLower(strings.TrimSpace(value)), "e")
+
+	places := 0
+	if _, fraction, found := strings.Cut(mantissa, "."); found {
+		places = len(fraction)
+	}
+
+	// 指数表記の場合は指数の分だけ小数点が移動する(1.5e-3 は 0.0015)
+	if exponent != "" {
+		if e, err := strconv.Atoi(exponent); err == nil {
+			places -= e
+		}
+	}
+
+	return max(places, 0)
+}
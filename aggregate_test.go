@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_Aggregate_JUnit(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/junit",
+			"-m", "mapping/junit-summary.json",
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"classname,tests,skipped,failures,errors,time,max time",
+		"com.github.onozaty.junit.xml2csv.TestCase1,5,1,1,1,0.034,0.02",
+		"com.github.onozaty.junit.xml2csv.TestCase2,2,0,0,0,0.003,0.002",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Aggregate_Functions(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><group>a</group><value>10</value><code>x</code></item>
+	<item><group>b</group><value>1.5</value><code>y</code></item>
+	<item><group>a</group><value>9</value><code>x</code></item>
+	<item><group>a</group><value></value><code>z</code></item>
+	<item><group>c</group></item>
+	<item><group>a</group><value>100</value></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.yaml", `
+rowsPath: //item
+columns:
+  - header: group
+    valuePath: /group
+  - header: value
+    valuePath: /value
+  - header: code
+    valuePath: /code
+groupBy: [group]
+aggregates:
+  - header: rows
+    function: count
+  - header: values
+    function: count
+    column: value
+  - header: codes
+    function: countDistinct
+    column: code
+  - header: sum
+    function: sum
+    column: value
+  - header: min
+    function: min
+    column: value
+  - header: max
+    function: max
+    column: value
+  - header: avg
+    function: avg
+    column: value
+`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+			"--null-value", "NULL",
+			"--sort-by", "rows:desc:numeric",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"group,rows,values,codes,sum,min,max,avg",
+		"a,4,3,2,119,9,100,39.666667",
+		"b,1,1,1,1.5,1.5,1.5,1.5",
+		"c,1,0,0,NULL,NULL,NULL,NULL",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Aggregate_WithoutGroupBy(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root></root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "value",
+				"valuePath": "/value"
+			}
+		],
+		"aggregates": [
+			{
+				"header": "count",
+				"function": "count"
+			},
+			{
+				"header": "sum",
+				"function": "sum",
+				"column": "value"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// 行が無くても全体の集計結果が出力される
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"count,sum",
+		"0,",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Aggregate_Exponent(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><value>1.5e-3</value></item>
+	<item><value>2e-4</value></item>
+	<item><value>1</value></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "value",
+				"valuePath": "/value"
+			}
+		],
+		"aggregates": [
+			{
+				"header": "sum",
+				"function": "sum",
+				"column": "value"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// 指数表記の小数点以下の桁数に揃える
+	assert.Equal(t, joinRows("sum", "1.0017"), readString(t, outputPath))
+}
+
+func TestRun_Aggregate_LargeExponent(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><value>1e-100000000</value></item>
+	<item><value>3e-20</value></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "value",
+				"valuePath": "/value"
+			}
+		],
+		"aggregates": [
+			{
+				"header": "sum",
+				"function": "sum",
+				"column": "value"
+			},
+			{
+				"header": "avg",
+				"function": "avg",
+				"column": "value"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// float64の精度を超える桁数は指数表記
+	assert.Equal(t, joinRows("sum,avg", "3e-20,1.5e-20"), readString(t, outputPath))
+}
+
+func TestRun_Aggregate_NotNumber(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><value>1</value></item>
+	<item><value>abc</value></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "value",
+				"valuePath": "/value"
+			}
+		],
+		"aggregates": [
+			{
+				"header": "total",
+				"function": "sum",
+				"column": "value"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := fmt.Sprintf("%s is failed: row 2: aggregate 'total': 'abc' is not a number\n", inputPath)
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_InvalidAggregation(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		aggregation string
+		expect      string
+	}{
+		{
+			name:        "groupBy",
+			aggregation: `"groupBy": ["name"]`,
+			expect:      "invalid mapping: groupBy 'name' is not a header of the columns\n",
+		},
+		{
+			name:        "header",
+			aggregation: `"aggregates": [{"function": "count"}]`,
+			expect:      "invalid mapping: aggregates[0]: header is required\n",
+		},
+		{
+			name:        "function",
+			aggregation: `"aggregates": [{"header": "x", "function": "median", "column": "title"}]`,
+			expect:      "invalid mapping: aggregates[0]: function must be one of count, sum, min, max, avg, countDistinct\n",
+		},
+		{
+			name:        "column required",
+			aggregation: `"aggregates": [{"header": "x", "function": "sum"}]`,
+			expect:      "invalid mapping: aggregates[0]: column is required for sum\n",
+		},
+		{
+			name:        "column",
+			aggregation: `"aggregates": [{"header": "x", "function": "count", "column": "name"}]`,
+			expect:      "invalid mapping: aggregates[0]: column 'name' is not a header of the columns\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+
+			mappingPath := createFile(t, temp, "mapping.json", fmt.Sprintf(`
+			{
+				"rowsPath": "//item",
+				"columns": [
+					{
+						"header": "title",
+						"valuePath": "/title"
+					}
+				],
+				%s
+			}`, tt.aggregation))
+
+			out := new(bytes.Buffer)
+
+			// ACT
+			exitCode := run(
+				[]string{
+					"-i", "testdata/rss.xml",
+					"-m", mappingPath,
+					"-o", filepath.Join(temp, "output.csv"),
+				},
+				out,
+			)
+
+			// ASSERT
+			require.Equal(t, NG, exitCode)
+			assert.Equal(t, tt.expect, out.String())
+		})
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+
+	assert.Equal(t, "1.50", formatDecimal(1.5, 2))
+	assert.Equal(t, "100", formatDecimal(100, 0))
+	assert.Equal(t, "0.00150000000000000", formatDecimal(0.0015, 17))
+	assert.Equal(t, "0.0015", formatDecimal(0.0015, 18))
+	assert.Equal(t, "1e-300", formatDecimal(1e-300, 300))
+}
+
+func TestDecimalPlaces(t *testing.T) {
+
+	assert.Equal(t, 0, decimalPlaces("10"))
+	assert.Equal(t, 3, decimalPlaces(" 0.034 "))
+	assert.Equal(t, 0, decimalPlaces("1.25e3"))
+	assert.Equal(t, 1, decimalPlaces("1.25E1"))
+	assert.Equal(t, 4, decimalPlaces("1.5e-3"))
+	assert.Equal(t, 3, decimalPlaces("2e-3"))
+	assert.Equal(t, 2, decimalPlaces("-0.25e+0"))
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Constraints カラムの値の制約(値が存在しない、もしくは空の場合は判定しない)
+type Constraints struct {
+	// Pattern 値全体が一致する必要がある正規表現
+	Pattern string `json:"pattern,omitempty" yaml:"pattern" toml:"pattern"`
+	// Enum 許可する値
+	Enum []string `json:"enum,omitempty" yaml:"enum" toml:"enum"`
+	// Min 数値としての最小値
+	Min *float64 `json:"min,omitempty" yaml:"min" toml:"min"`
+	// Max 数値としての最大値
+	Max *float64 `json:"max,omitempty" yaml:"max" toml:"max"`
+	// MaxLength 最大の文字数
+	MaxLength *int `json:"maxLength,omitempty" yaml:"maxLength" toml:"maxLength"`
+	// Unique 全ての入力で値が重複しない
+	Unique bool `json:"unique,omitempty" yaml:"unique" toml:"unique"`
+}
+
+// constraintRowWriter 制約に違反する行をinvalidRowErrorとして出力せずに返す
+type constraintRowWriter struct {
+	writer   rowWriter
+	columns  []columnConstraints
+	uniqueOf []*hashSet
+}
+
+type columnConstraints struct {
+	header      string
+	constraints *Constraints
+	pattern     *regexp.Regexp
+}
+
+// validateConstraints checks the pattern and the ranges of the constraints.
+func validateConstraints(constraints *Constraints) error {
+
+	if constraints.Pattern != "" {
+		if _, err := compileConstraintPattern(constraints.Pattern); err != nil {
+			return fmt.Errorf("constraints pattern '%s' is invalid: %w", constraints.Pattern, err)
+		}
+	}
+
+	if constraints.Min != nil && constraints.Max != nil && *constraints.Min > *constraints.Max {
+		return fmt.Errorf("constraints min must be less than or equal to max")
+	}
+
+	if constraints.MaxLength != nil && *constraints.MaxLength < 0 {
+		return fmt.Errorf("constraints maxLength must be 0 or more")
+	}
+
+	return nil
+}
+
+// hasConstraints reports whether any column has the constraints.
+func (m *Mapping) hasConstraints() bool {
+	return slices.ContainsFunc(m.Columns, func(column Column) bool { return column.Constraints != nil })
+}
+
+func newConstraintRowWriter(writer rowWriter, columns []Column) *constraintRowWriter {
+
+	w := &constraintRowWriter{writer: writer}
+	for _, column := range columns {
+		columnConstraints := columnConstraints{header: column.Header, constraints: column.Constraints}
+
+		var uniqueValues *hashSet
+		if column.Constraints != nil {
+			if column.Constraints.Pattern != "" {
+				// validateConstraintsで確認済み
+				pattern, _ := compileConstraintPattern(column.Constraints.Pattern)
+				columnConstraints.pattern = pattern
+			}
+
+			if column.Constraints.Unique {
+				uniqueValues = newHashSet(distinctMemoryEntries)
+			}
+		}
+
+		w.columns = append(w.columns, columnConstraints)
+		w.uniqueOf = append(w.uniqueOf, uniqueValues)
+	}
+
+	return w
+}
+
+func (w *constraintRowWriter) Write(values []*string) error {
+
+	for i, value := range values {
+		if value == nil || *value == "" || w.columns[i].constraints == nil {
+			continue
+		}
+
+		if message := w.columns[i].check(*value); message != "" {
+			return &invalidRowError{message: fmt.Sprintf("column '%s': %s", w.columns[i].header, message)}
+		}
+	}
+
+	// 違反した行の値を記録しないよう、他の制約を判定した後に重複を判定
+	for i, value := range values {
+		if value == nil || *value == "" || w.uniqueOf[i] == nil {
+			continue
+		}
+
+		added, err := w.uniqueOf[i].add(sha256.Sum256([]byte(*value)))
+		if err != nil {
+			return err
+		}
+		if !added {
+			return &invalidRowError{message: fmt.Sprintf("column '%s': '%s' is duplicated", w.columns[i].header, *value)}
+		}
+	}
+
+	return w.writer.Write(values)
+}
+
+func (w *constraintRowWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+// close removes the temporary files of the unique values.
+func (w *constraintRowWriter) close() {
+
+	for _, uniqueValues := range w.uniqueOf {
+		if uniqueValues != nil {
+			uniqueValues.remove()
+		}
+	}
+}
+
+// check checks the value against the constraints except unique, and returns the violation message.
+func (c *columnConstraints) check(value string) string {
+
+	constraints := c.constraints
+
+	if c.pattern != nil && !c.pattern.MatchString(value) {
+		return fmt.Sprintf("'%s' does not match pattern '%s'", value, constraints.Pattern)
+	}
+
+	if len(constraints.Enum) != 0 && !slices.Contains(constraints.Enum, value) {
+		return fmt.Sprintf("'%s' is not one of %s", value, strings.Join(constraints.Enum, ", "))
+	}
+
+	if constraints.Min != nil || constraints.Max != nil {
+		// NaNやInf、16進数はParseFloatでは数値となるため、10進数の表記のみ数値とする
+		trimmed := strings.TrimSpace(value)
+		number, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil || !numericPattern.MatchString(trimmed) {
+			return fmt.Sprintf("'%s' is not a number", value)
+		}
+		if constraints.Min != nil && number < *constraints.Min {
+			return fmt.Sprintf("'%s' is less than %s", value, formatNumber(*constraints.Min))
+		}
+		if constraints.Max != nil && number > *constraints.Max {
+			return fmt.Sprintf("'%s' is greater than %s", value, formatNumber(*constraints.Max))
+		}
+	}
+
+	if constraints.MaxLength != nil && utf8.RuneCountInString(value) > *constraints.MaxLength {
+		return fmt.Sprintf("'%s' is longer than %d characters", value, *constraints.MaxLength)
+	}
+
+	return ""
+}
+
+// compileConstraintPattern compiles the pattern to match the whole value.
+func compileConstraintPattern(pattern string) (*regexp.Regexp, error) {
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
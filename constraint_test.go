@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const constraintsMapping = `
+{
+	"rowsPath": "//item",
+	"onInvalidRow": "%s",
+	"columns": [
+		{
+			"header": "code",
+			"valuePath": "/code",
+			"constraints": {
+				"pattern": "[A-Z]{2}[0-9]+",
+				"maxLength": 5,
+				"unique": true
+			}
+		},
+		{
+			"header": "status",
+			"valuePath": "/status",
+			"constraints": {
+				"enum": ["active", "closed"]
+			}
+		},
+		{
+			"header": "price",
+			"valuePath": "/price",
+			"constraints": {
+				"min": 0,
+				"max": 1000
+			}
+		}
+	]
+}`
+
+func TestRun_Constraints(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><code>AB1</code><status>active</status><price>100</price></item>
+	<item><code>AB2</code><status>open</status><price>100</price></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", fmt.Sprintf(constraintsMapping, "error"))
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := inputPath + " is failed: row 2: column 'status': 'open' is not one of active, closed\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_Constraints_Skip(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "input")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	createFile(t, inputDir, "1.xml", `<root>
+	<item><code>AB1</code><status>active</status><price>100</price></item>
+	<item><code>ab2</code><status>active</status><price>100</price></item>
+	<item><code>AB123</code><status>closed</status><price>1000</price></item>
+	<item><code>AB1234</code><status>closed</status><price>0</price></item>
+	<item><code>AB5</code><status>closed</status><price>-1</price></item>
+	<item><code>AB5</code><status>closed</status><price>free</price></item>
+	<item><code>AB5</code><price>0</price></item>
+	</root>`)
+
+	// 重複はファイルをまたいで判定
+	createFile(t, inputDir, "2.xml", `<root>
+	<item><code>AB1</code><status>closed</status><price>1</price></item>
+	<item><code>AB6</code><status>closed</status><price>1</price></item>
+	<item><code>AB5</code><status>closed</status><price>1</price></item>
+	<item><status>closed</status><price>1</price></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", fmt.Sprintf(constraintsMapping, "skip"))
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputDir,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	// 読み飛ばした行はメッセージを出力
+	path1 := filepath.Join(inputDir, "1.xml")
+	path2 := filepath.Join(inputDir, "2.xml")
+	expectMessage := fmt.Sprintf("skipped: %s: row 2: column 'code': 'ab2' does not match pattern '[A-Z]{2}[0-9]+'\n", path1) +
+		fmt.Sprintf("skipped: %s: row 4: column 'code': 'AB1234' is longer than 5 characters\n", path1) +
+		fmt.Sprintf("skipped: %s: row 5: column 'price': '-1' is less than 0\n", path1) +
+		fmt.Sprintf("skipped: %s: row 6: column 'price': 'free' is not a number\n", path1) +
+		fmt.Sprintf("skipped: %s: row 1: column 'code': 'AB1' is duplicated\n", path2) +
+		fmt.Sprintf("skipped: %s: row 3: column 'code': 'AB5' is duplicated\n", path2)
+	assert.Equal(t, expectMessage, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"code,status,price",
+		"AB1,active,100",
+		"AB123,closed,1000",
+		"AB5,,0",
+		"AB6,closed,1",
+		",closed,1",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_InvalidConstraints(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		constraints string
+		expect      string
+	}{
+		{
+			name:        "pattern",
+			constraints: `{"pattern": "[a-"}`,
+			expect:      "invalid mapping: column 'title' constraints pattern '[a-' is invalid: error parsing regexp: missing closing ]: `[a-`\n",
+		},
+		{
+			name:        "range",
+			constraints: `{"min": 10, "max": 1}`,
+			expect:      "invalid mapping: column 'title' constraints min must be less than or equal to max\n",
+		},
+		{
+			name:        "maxLength",
+			constraints: `{"maxLength": -1}`,
+			expect:      "invalid mapping: column 'title' constraints maxLength must be 0 or more\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+
+			mappingPath := createFile(t, temp, "mapping.json", `
+			{
+				"rowsPath": "//item",
+				"columns": [
+					{
+						"header": "title",
+						"valuePath": "/title",
+						"constraints": `+tt.constraints+`
+					}
+				]
+			}`)
+
+			out := new(bytes.Buffer)
+
+			// ACT
+			exitCode := run(
+				[]string{
+					"-i", "testdata/rss.xml",
+					"-m", mappingPath,
+					"-o", filepath.Join(temp, "output.csv"),
+				},
+				out,
+			)
+
+			// ASSERT
+			require.Equal(t, NG, exitCode)
+			assert.Equal(t, tt.expect, out.String())
+		})
+	}
+}
+
+func TestColumnConstraints_Check(t *testing.T) {
+
+	minValue := 1.5
+	maxLength := 3
+
+	tests := []struct {
+		name        string
+		constraints Constraints
+		value       string
+		expect      string
+	}{
+		{
+			name:        "pattern",
+			constraints: Constraints{Pattern: `\d+`},
+			value:       "12a",
+			expect:      "'12a' does not match pattern '\\d+'",
+		},
+		{
+			name:        "pattern alternation",
+			constraints: Constraints{Pattern: `a|b`},
+			value:       "ab",
+			expect:      "'ab' does not match pattern 'a|b'",
+		},
+		{
+			name:        "min",
+			constraints: Constraints{Min: &minValue},
+			value:       "1.4",
+			expect:      "'1.4' is less than 1.5",
+		},
+		{
+			name:        "not number",
+			constraints: Constraints{Min: &minValue},
+			value:       "abc",
+			expect:      "'abc' is not a number",
+		},
+		{
+			name:        "NaN",
+			constraints: Constraints{Min: &minValue},
+			value:       "NaN",
+			expect:      "'NaN' is not a number",
+		},
+		{
+			name:        "Inf",
+			constraints: Constraints{Min: &minValue},
+			value:       "+Inf",
+			expect:      "'+Inf' is not a number",
+		},
+		{
+			name:        "hex",
+			constraints: Constraints{Min: &minValue},
+			value:       "0x1p3",
+			expect:      "'0x1p3' is not a number",
+		},
+		{
+			name:        "exponent",
+			constraints: Constraints{Min: &minValue},
+			value:       " 2e0 ",
+			expect:      "",
+		},
+		{
+			name:        "maxLength",
+			constraints: Constraints{MaxLength: &maxLength},
+			value:       "あいうえ",
+			expect:      "'あいうえ' is longer than 3 characters",
+		},
+		{
+			name:        "valid",
+			constraints: Constraints{Pattern: `\d+`, Min: &minValue, MaxLength: &maxLength},
+			value:       "10",
+			expect:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			writer := newConstraintRowWriter(nil, []Column{{Header: "value", Constraints: &tt.constraints}})
+
+			// ACT
+			message := writer.columns[0].check(tt.value)
+
+			// ASSERT
+			assert.Equal(t, tt.expect, message)
+		})
+	}
+}
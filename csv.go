@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// QuoteStyle CSVの値を囲む方法
+type QuoteStyle string
+
+const (
+	// QuoteMinimal 区切り文字、囲み文字、改行を含む値のみ囲む
+	QuoteMinimal QuoteStyle = "minimal"
+	// QuoteAlways 全ての値を囲む
+	QuoteAlways QuoteStyle = "always"
+	// QuoteNever 囲まない(区切り文字や改行はエスケープ文字で区別)
+	QuoteNever QuoteStyle = "never"
+	// QuoteNonNumeric 数値以外の値を囲む
+	QuoteNonNumeric QuoteStyle = "nonnumeric"
+)
+
+const (
+	LineEndingCRLF = "crlf"
+	LineEndingLF   = "lf"
+)
+
+var numericPattern = regexp.MustCompile(`^[+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?$`)
+
+// csvWriter 囲み方やエスケープを指定してCSVを出力
+type csvWriter struct {
+	delimiter rune
+	quote     rune
+	quoting   QuoteStyle
+	// escape 0の場合は囲み文字を重ねてエスケープ
+	escape          rune
+	recordSeparator string
+	// nullValue 該当するノードが存在しない値(囲みやエスケープをせずに出力)
+	nullValue string
+	writer    *bufio.Writer
+}
+
+func parseQuoteStyle(value string) (QuoteStyle, error) {
+
+	switch QuoteStyle(strings.ToLower(value)) {
+	case "", QuoteMinimal:
+		return QuoteMinimal, nil
+	case QuoteAlways:
+		return QuoteAlways, nil
+	case QuoteNever:
+		return QuoteNever, nil
+	case QuoteNonNumeric:
+		return QuoteNonNumeric, nil
+	}
+
+	return "", fmt.Errorf("quote must be one of always, minimal, never, nonnumeric")
+}
+
+// parseLineEnding returns the record separator of the line ending.
+func parseLineEnding(value string) (string, error) {
+
+	switch strings.ToLower(value) {
+	case "", LineEndingCRLF:
+		return "\r\n", nil
+	case LineEndingLF:
+		return "\n", nil
+	}
+
+	return "", fmt.Errorf("line ending must be one of crlf, lf")
+}
+
+// getCharRune parses a single character specification such as '"' or '\\'. An empty specification is 0.
+func getCharRune(name string, value string) (rune, error) {
+
+	if value == "" {
+		return 0, nil
+	}
+
+	unescaped, err := unescapeString(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if len([]rune(unescaped)) != 1 {
+		return 0, fmt.Errorf("%s must be a single character", name)
+	}
+
+	return []rune(unescaped)[0], nil
+}
+
+// validateCSVFormat checks that the special characters of the CSV are distinct.
+func validateCSVFormat(format Format) error {
+
+	quote := format.QuoteChar
+	if quote == 0 {
+		quote = '"'
+	}
+
+	if quote == format.Delimiter {
+		return fmt.Errorf("quote character must be different from the delimiter")
+	}
+
+	if format.EscapeChar != 0 && (format.EscapeChar == format.Delimiter || format.EscapeChar == quote) {
+		return fmt.Errorf("escape character must be different from the delimiter and the quote character")
+	}
+
+	return nil
+}
+
+func newCSVWriter(writer io.Writer, format Format) (*csvWriter, error) {
+
+	if format.WithBom {
+		// BOMを付与
+		if _, err := writer.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &csvWriter{
+		delimiter:       format.Delimiter,
+		quote:           format.QuoteChar,
+		quoting:         format.Quoting,
+		escape:          format.EscapeChar,
+		recordSeparator: format.LineEnding,
+		nullValue:       format.NullValue,
+		writer:          bufio.NewWriter(writer),
+	}
+
+	// 指定しない場合はRFC 4180と同じ
+	if w.delimiter == 0 {
+		w.delimiter = ','
+	}
+	if w.quote == 0 {
+		w.quote = '"'
+	}
+	if w.quoting == "" {
+		w.quoting = QuoteMinimal
+	}
+	if w.recordSeparator == "" {
+		w.recordSeparator = "\r\n"
+	}
+
+	return w, nil
+}
+
+// Write writes the record.
+func (w *csvWriter) Write(record []string) error {
+
+	values := make([]*string, len(record))
+	for i := range record {
+		values[i] = &record[i]
+	}
+
+	return w.writeValues(values)
+}
+
+// writeValues writes the values, writing nil as the null value.
+func (w *csvWriter) writeValues(values []*string) error {
+
+	var line strings.Builder
+	for i, value := range values {
+		if i > 0 {
+			line.WriteRune(w.delimiter)
+		}
+
+		if value == nil {
+			line.WriteString(w.nullValue)
+			continue
+		}
+
+		field, err := w.formatField(*value)
+		if err != nil {
+			return err
+		}
+		line.WriteString(field)
+	}
+	line.WriteString(w.recordSeparator)
+
+	_, err := w.writer.WriteString(line.String())
+	return err
+}
+
+func (w *csvWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+// formatField quotes and escapes the field according to the quote style.
+func (w *csvWriter) formatField(field string) (string, error) {
+
+	if !w.needsQuotes(field) {
+		return w.escapeUnquoted(field)
+	}
+
+	var quoted strings.Builder
+	quoted.WriteRune(w.quote)
+	for _, r := range field {
+		switch {
+		case r == w.quote && w.escape != 0:
+			quoted.WriteRune(w.escape)
+		case r == w.quote:
+			// エスケープ文字が無い場合は囲み文字を重ねる
+			quoted.WriteRune(w.quote)
+		case r == w.escape && w.escape != 0:
+			quoted.WriteRune(w.escape)
+		}
+		quoted.WriteRune(r)
+	}
+	quoted.WriteRune(w.quote)
+
+	return quoted.String(), nil
+}
+
+func (w *csvWriter) needsQuotes(field string) bool {
+
+	switch w.quoting {
+	case QuoteAlways:
+		return true
+	case QuoteNever:
+		return false
+	case QuoteNonNumeric:
+		return !numericPattern.MatchString(field)
+	}
+
+	return strings.ContainsRune(field, w.delimiter) || strings.ContainsRune(field, w.quote) ||
+		strings.ContainsAny(field, w.recordSeparator) || strings.ContainsAny(field, "\r\n")
+}
+
+// escapeUnquoted escapes the delimiter, the line breaks and the escape character in the field without quotes.
+func (w *csvWriter) escapeUnquoted(field string) (string, error) {
+
+	special := func(r rune) bool {
+		return r == w.delimiter || r == '\r' || r == '\n' || (w.escape != 0 && r == w.escape)
+	}
+
+	if !strings.ContainsFunc(field, special) {
+		return field, nil
+	}
+
+	if w.escape == 0 {
+		return "", fmt.Errorf("value '%s' cannot be written without quotes, specify the escape character", field)
+	}
+
+	var escaped strings.Builder
+	for _, r := range field {
+		if special(r) {
+			escaped.WriteRune(w.escape)
+		}
+		escaped.WriteRune(r)
+	}
+
+	return escaped.String(), nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_Quote(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>a,b</name></item>
+	<item><id>2</id><name>say "hi"</name></item>
+	<item><id>3</id></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "name=/name",
+			"-o", outputPath,
+			"--quote", "nonnumeric",
+			"--quote-char", "'",
+			"--line-ending", "lf",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	expect := "'id','name'\n" +
+		"1,'a,b'\n" +
+		"2,'say \"hi\"'\n" +
+		"3,\n"
+	assert.Equal(t, expect, readString(t, outputPath))
+}
+
+func TestRun_Quote_Escape(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><path>C:\temp</path></item>
+	<item><id>2</id><path>a	b</path></item>
+	<item><id>3</id></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.tsv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	// MySQLのLOAD DATAのデフォルトの形式
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "path=/path",
+			"-o", outputPath,
+			"-d", `\t`,
+			"--quote", "never",
+			"--escape-char", `\\`,
+			"--null-value", `\N`,
+			"--line-ending", "lf",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	expect := "id\tpath\n" +
+		"1\tC:\\\\temp\n" +
+		"2\ta\\\tb\n" +
+		"3\t\\N\n"
+	assert.Equal(t, expect, readString(t, outputPath))
+}
+
+func TestRun_Quote_NeverWithoutEscape(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><name>a</name></item>
+	<item><name>a,b</name></item>
+	</root>`)
+
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "name=/name",
+			"-o", filepath.Join(temp, "output.csv"),
+			"--quote", "never",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := inputPath + " is failed: row 2: value 'a,b' cannot be written without quotes, specify the escape character\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_Quote_Invalid(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		arguments []string
+		expect    string
+	}{
+		{
+			name:      "quote",
+			arguments: []string{"--quote", "all"},
+			expect:    "Invalid quote specification: quote must be one of always, minimal, never, nonnumeric\n",
+		},
+		{
+			name:      "quote-char",
+			arguments: []string{"--quote-char", "''"},
+			expect:    "Invalid quote-char specification: quote character must be a single character\n",
+		},
+		{
+			name:      "escape-char",
+			arguments: []string{"--escape-char", "ab"},
+			expect:    "Invalid escape-char specification: escape character must be a single character\n",
+		},
+		{
+			name:      "line-ending",
+			arguments: []string{"--line-ending", "cr"},
+			expect:    "Invalid line-ending specification: line ending must be one of crlf, lf\n",
+		},
+		{
+			name:      "quote same as delimiter",
+			arguments: []string{"--quote-char", ";", "-d", ";"},
+			expect:    "Invalid CSV specification: quote character must be different from the delimiter\n",
+		},
+		{
+			name:      "escape same as quote",
+			arguments: []string{"--escape-char", `"`},
+			expect:    "Invalid CSV specification: escape character must be different from the delimiter and the quote character\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			out := new(bytes.Buffer)
+
+			// ACT
+			exitCode := run(
+				append([]string{
+					"-i", "testdata/rss.xml",
+					"-m", "mapping/rss.json",
+					"-o", filepath.Join(t.TempDir(), "output.csv"),
+				}, tt.arguments...),
+				out,
+			)
+
+			// ASSERT
+			require.Equal(t, NG, exitCode)
+			assert.Equal(t, tt.expect, out.String())
+		})
+	}
+}
+
+func TestCSVWriter_Write(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		format Format
+		expect string
+	}{
+		{
+			name:   "default",
+			format: Format{},
+			expect: "1,\"a,b\",\"say \"\"hi\"\"\",,NULL,C:\\dir,\"x\ny\",-1.5e3\r\n",
+		},
+		{
+			name:   "always",
+			format: Format{Quoting: QuoteAlways},
+			expect: "\"1\",\"a,b\",\"say \"\"hi\"\"\",\"\",NULL,\"C:\\dir\",\"x\ny\",\"-1.5e3\"\r\n",
+		},
+		{
+			name:   "nonnumeric",
+			format: Format{Quoting: QuoteNonNumeric},
+			expect: "1,\"a,b\",\"say \"\"hi\"\"\",\"\",NULL,\"C:\\dir\",\"x\ny\",-1.5e3\r\n",
+		},
+		{
+			name:   "minimal escape",
+			format: Format{Quoting: QuoteMinimal, EscapeChar: '\\'},
+			expect: "1,\"a,b\",\"say \\\"hi\\\"\",,NULL,C:\\\\dir,\"x\ny\",-1.5e3\r\n",
+		},
+		{
+			name:   "always escape",
+			format: Format{Quoting: QuoteAlways, EscapeChar: '\\'},
+			expect: "\"1\",\"a,b\",\"say \\\"hi\\\"\",\"\",NULL,\"C:\\\\dir\",\"x\ny\",\"-1.5e3\"\r\n",
+		},
+		{
+			name:   "never escape",
+			format: Format{Quoting: QuoteNever, EscapeChar: '\\'},
+			expect: "1,a\\,b,say \"hi\",,NULL,C:\\\\dir,x\\\ny,-1.5e3\r\n",
+		},
+		{
+			name:   "quote char",
+			format: Format{Quoting: QuoteMinimal, QuoteChar: '\''},
+			expect: "1,'a,b',say \"hi\",,NULL,C:\\dir,'x\ny',-1.5e3\r\n",
+		},
+		{
+			name:   "delimiter and lf",
+			format: Format{Delimiter: ';', LineEnding: "\n"},
+			expect: "1;a,b;\"say \"\"hi\"\"\";;NULL;C:\\dir;\"x\ny\";-1.5e3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			b := new(bytes.Buffer)
+			tt.format.NullValue = "NULL"
+			writer, err := newCSVWriter(b, tt.format)
+			require.NoError(t, err)
+
+			record := []string{"1", "a,b", `say "hi"`, "", "", `C:\dir`, "x\ny", "-1.5e3"}
+			values := []*string{&record[0], &record[1], &record[2], &record[3], nil, &record[5], &record[6], &record[7]}
+
+			// ACT
+			err = writer.writeValues(values)
+			require.NoError(t, err)
+			require.NoError(t, writer.Flush())
+
+			// ASSERT
+			assert.Equal(t, tt.expect, b.String())
+		})
+	}
+}
+
+func TestCSVWriter_Write_NUL(t *testing.T) {
+
+	// ARRANGE
+	b := new(bytes.Buffer)
+	writer, err := newCSVWriter(b, Format{})
+	require.NoError(t, err)
+
+	// ACT
+	// エスケープ文字が無い場合にNULを重ねない
+	err = writer.Write([]string{"a\x00b", "c,\x00"})
+	require.NoError(t, err)
+	require.NoError(t, writer.Flush())
+
+	// ASSERT
+	assert.Equal(t, "a\x00b,\"c,\x00\"\r\n", b.String())
+}
+
+func TestCSVWriter_Write_NeverWithoutEscape(t *testing.T) {
+
+	tests := []string{"a,b", "a\nb", "a\rb"}
+
+	for _, value := range tests {
+		t.Run(value, func(t *testing.T) {
+
+			// ARRANGE
+			writer, err := newCSVWriter(new(bytes.Buffer), Format{Quoting: QuoteNever})
+			require.NoError(t, err)
+
+			// ACT
+			err = writer.Write([]string{value})
+
+			// ASSERT
+			require.Error(t, err)
+		})
+	}
+}
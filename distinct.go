@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// Distinct 重複する行の除外(Keysを省略した場合は行全体で判定)
+type Distinct struct {
+	// Keys 重複の判定に使うカラムのヘッダ
+	Keys []string `json:"keys,omitempty" yaml:"keys" toml:"keys"`
+	// Keep 重複した行のうち残す行(first: 最初の行、last: 最後の行)
+	Keep string `json:"keep,omitempty" yaml:"keep" toml:"keep"`
+}
+
+const (
+	DistinctKeepFirst = "first"
+	DistinctKeepLast  = "last"
+)
+
+// distinctMemoryEntries メモリ上に保持するキーの数(超えた分は一時ファイルに退避)
+var distinctMemoryEntries = 1 << 20
+
+// distinctMergeFanIn 同じ階層の退避ファイルがこの数そろったらマージ(判定時に確認するファイルの数を抑える)
+var distinctMergeFanIn = 8
+
+// hashBlockEntries 退避ファイルの索引の間隔(判定時はこの件数のブロックのみ読み込む)
+const hashBlockEntries = 128
+
+// bloomBitsPerEntry ブルームフィルタの1件あたりのビット数(偽陽性は約1%)
+const (
+	bloomBitsPerEntry = 10
+	bloomHashes       = 7
+)
+
+type rowHash [sha256.Size]byte
+
+// hashSet 行のハッシュの集合(メモリ上の件数が上限を超えた場合はソートして一時ファイルへ退避)
+type hashSet struct {
+	memory map[rowHash]struct{}
+	limit  int
+	// runs 退避した順のソート済みのファイル
+	runs []*hashRun
+}
+
+// hashRun ソート済みのハッシュを書き込んだ退避ファイル(書き込み後は変更しない)
+type hashRun struct {
+	file   *os.File
+	writer *bufio.Writer
+	count  int64
+	// level マージした回数
+	level  int
+	filter bloomFilter
+	// fences ブロックごとの先頭のハッシュ
+	fences []rowHash
+	buffer []byte
+}
+
+// bloomFilter 退避ファイルに含まれないハッシュを読み込まずに判定
+type bloomFilter []uint64
+
+// distinctRowWriter 重複する行を除外して出力
+type distinctRowWriter struct {
+	writer  rowWriter
+	indexes []int
+	keep    string
+	seen    *hashSet
+	spool   *rowSpool
+}
+
+// validateDistinct checks the keep and that the keys are headers of the columns.
+func validateDistinct(distinct *Distinct, columns []Column) error {
+
+	switch distinct.Keep {
+	case "", DistinctKeepFirst, DistinctKeepLast:
+	default:
+		return fmt.Errorf("distinct keep must be one of first, last")
+	}
+
+	for _, key := range distinct.Keys {
+		if !slices.ContainsFunc(columns, func(column Column) bool { return column.Header == key }) {
+			return fmt.Errorf("distinct key '%s' is not a header of the columns", key)
+		}
+	}
+
+	return nil
+}
+
+func newDistinctRowWriter(writer rowWriter, headers []string, distinct *Distinct) *distinctRowWriter {
+
+	var indexes []int
+	for _, key := range distinct.Keys {
+		indexes = append(indexes, slices.Index(headers, key))
+	}
+
+	return &distinctRowWriter{
+		writer:  writer,
+		indexes: indexes,
+		keep:    distinct.Keep,
+		seen:    newHashSet(distinctMemoryEntries),
+	}
+}
+
+func (w *distinctRowWriter) Write(values []*string) error {
+
+	if w.keep == DistinctKeepLast {
+		// 最後の行を残すため、全ての行を退避してから逆順に判定
+		if w.spool == nil {
+			spool, err := newRowSpool()
+			if err != nil {
+				return err
+			}
+			w.spool = spool
+		}
+
+		return w.spool.write(values)
+	}
+
+	added, err := w.seen.add(w.hash(values))
+	if err != nil || !added {
+		return err
+	}
+
+	return w.writer.Write(values)
+}
+
+func (w *distinctRowWriter) Flush() error {
+
+	if w.spool != nil {
+		// 逆順に最初の行を残すことで最後の行を残し、さらに逆順にして元の順序に戻す
+		reversed, err := newRowSpool()
+		if err != nil {
+			return err
+		}
+		defer reversed.remove()
+
+		err = w.spool.readReverse(func(values []*string) error {
+			added, err := w.seen.add(w.hash(values))
+			if err != nil || !added {
+				return err
+			}
+			return reversed.write(values)
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := reversed.readReverse(w.writer.Write); err != nil {
+			return err
+		}
+	}
+
+	return w.writer.Flush()
+}
+
+// close removes the temporary files.
+func (w *distinctRowWriter) close() {
+
+	if w.spool != nil {
+		w.spool.remove()
+	}
+	w.seen.remove()
+}
+
+func (w *distinctRowWriter) hash(values []*string) rowHash {
+
+	if len(w.indexes) == 0 {
+		return sha256.Sum256(encodeRow(values))
+	}
+
+	keys := make([]*string, len(w.indexes))
+	for i, index := range w.indexes {
+		keys[i] = values[index]
+	}
+
+	return sha256.Sum256(encodeRow(keys))
+}
+
+func newHashSet(limit int) *hashSet {
+	return &hashSet{memory: map[rowHash]struct{}{}, limit: limit}
+}
+
+// add adds the hash, and returns false if it has already been added.
+func (s *hashSet) add(hash rowHash) (bool, error) {
+
+	if _, found := s.memory[hash]; found {
+		return false, nil
+	}
+
+	for _, run := range s.runs {
+		found, err := run.contains(hash)
+		if err != nil || found {
+			return false, err
+		}
+	}
+
+	s.memory[hash] = struct{}{}
+	if len(s.memory) >= s.limit {
+		if err := s.spill(); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// spill writes the sorted hashes in memory to a new temporary file.
+// When distinctMergeFanIn files of the same level are written, they are merged into one file of the next level,
+// so each hash is rewritten only a few times.
+func (s *hashSet) spill() error {
+
+	hashes := make([]rowHash, 0, len(s.memory))
+	for hash := range s.memory {
+		hashes = append(hashes, hash)
+	}
+	slices.SortFunc(hashes, func(a, b rowHash) int { return bytes.Compare(a[:], b[:]) })
+
+	run, err := newHashRun(int64(len(hashes)), 0)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if err := run.write(hash); err != nil {
+			run.remove()
+			return err
+		}
+	}
+	if err := run.finish(); err != nil {
+		run.remove()
+		return err
+	}
+
+	s.runs = append(s.runs, run)
+	s.memory = map[rowHash]struct{}{}
+
+	// 階層は退避した順に高い方から並ぶため、末尾がそろっていればマージ
+	for len(s.runs) >= distinctMergeFanIn {
+		group := s.runs[len(s.runs)-distinctMergeFanIn:]
+		if group[0].level != group[len(group)-1].level {
+			break
+		}
+
+		merged, err := mergeHashRuns(group)
+		if err != nil {
+			return err
+		}
+		s.runs = append(s.runs[:len(s.runs)-distinctMergeFanIn], merged)
+	}
+
+	return nil
+}
+
+// remove closes and removes the spilled files.
+func (s *hashSet) remove() {
+
+	for _, run := range s.runs {
+		run.remove()
+	}
+	s.runs = nil
+}
+
+func newHashRun(count int64, level int) (*hashRun, error) {
+
+	file, err := os.CreateTemp("", "xml2csv-distinct-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &hashRun{
+		file:   file,
+		writer: bufio.NewWriter(file),
+		level:  level,
+		filter: newBloomFilter(count),
+		buffer: make([]byte, hashBlockEntries*len(rowHash{})),
+	}, nil
+}
+
+// mergeHashRuns merges the sorted files into a new file of the next level, and removes the merged files.
+// The files do not contain the same hash, since a hash is spilled only when it is not found.
+func mergeHashRuns(group []*hashRun) (*hashRun, error) {
+
+	var count int64
+	level := 0
+	readers := make([]*bufio.Reader, len(group))
+	for i, run := range group {
+		count += run.count
+		level = max(level, run.level)
+		readers[i] = bufio.NewReader(io.NewSectionReader(run.file, 0, run.count*int64(len(rowHash{}))))
+	}
+
+	merged, err := newHashRun(count, level+1)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := merged.merge(readers); err != nil {
+		merged.remove()
+		return nil, err
+	}
+
+	for _, run := range group {
+		run.remove()
+	}
+
+	return merged, nil
+}
+
+// merge writes the hashes of the readers in order.
+func (r *hashRun) merge(readers []*bufio.Reader) error {
+
+	heads := make([]*rowHash, len(readers))
+	next := func(i int) error {
+		var hash rowHash
+		if _, err := io.ReadFull(readers[i], hash[:]); err == io.EOF {
+			heads[i] = nil
+			return nil
+		} else if err != nil {
+			return err
+		}
+		heads[i] = &hash
+		return nil
+	}
+
+	for i := range readers {
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+
+	for {
+		// マージする数は少ないため、最小のハッシュは順に比較して求める
+		minimum := -1
+		for i, head := range heads {
+			if head != nil && (minimum == -1 || bytes.Compare(head[:], heads[minimum][:]) < 0) {
+				minimum = i
+			}
+		}
+		if minimum == -1 {
+			break
+		}
+
+		if err := r.write(*heads[minimum]); err != nil {
+			return err
+		}
+		if err := next(minimum); err != nil {
+			return err
+		}
+	}
+
+	return r.finish()
+}
+
+// write appends the hash, which must be larger than the previous one.
+func (r *hashRun) write(hash rowHash) error {
+
+	if r.count%hashBlockEntries == 0 {
+		r.fences = append(r.fences, hash)
+	}
+	r.filter.add(hash)
+	r.count++
+
+	_, err := r.writer.Write(hash[:])
+	return err
+}
+
+func (r *hashRun) finish() error {
+
+	err := r.writer.Flush()
+	r.writer = nil
+	return err
+}
+
+// contains checks the bloom filter, and then searches the block which may contain the hash.
+func (r *hashRun) contains(hash rowHash) (bool, error) {
+
+	if !r.filter.mayContain(hash) {
+		return false, nil
+	}
+
+	index, found := slices.BinarySearchFunc(r.fences, hash, func(fence rowHash, target rowHash) int {
+		return bytes.Compare(fence[:], target[:])
+	})
+	if found {
+		return true, nil
+	}
+	if index == 0 {
+		// 先頭のハッシュより小さい
+		return false, nil
+	}
+
+	size := len(rowHash{})
+	block := int64(index - 1)
+	entries := min(int64(hashBlockEntries), r.count-block*hashBlockEntries)
+	buffer := r.buffer[:entries*int64(size)]
+	if _, err := r.file.ReadAt(buffer, block*hashBlockEntries*int64(size)); err != nil {
+		return false, err
+	}
+
+	low, high := 0, int(entries)
+	for low < high {
+		middle := (low + high) / 2
+		switch bytes.Compare(buffer[middle*size:(middle+1)*size], hash[:]) {
+		case 0:
+			return true, nil
+		case -1:
+			low = middle + 1
+		default:
+			high = middle
+		}
+	}
+
+	return false, nil
+}
+
+func (r *hashRun) remove() {
+
+	r.file.Close()
+	os.Remove(r.file.Name())
+}
+
+func newBloomFilter(entries int64) bloomFilter {
+	return make(bloomFilter, max((entries*bloomBitsPerEntry+63)/64, 1))
+}
+
+func (f bloomFilter) add(hash rowHash) {
+
+	for _, bit := range f.bits(hash) {
+		f[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f bloomFilter) mayContain(hash rowHash) bool {
+
+	for _, bit := range f.bits(hash) {
+		if f[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bits returns the positions of the hash, using the bytes of the hash as two independent hashes (double hashing).
+func (f bloomFilter) bits(hash rowHash) [bloomHashes]uint64 {
+
+	size := uint64(len(f)) * 64
+	h1 := binary.BigEndian.Uint64(hash[0:8])
+	h2 := binary.BigEndian.Uint64(hash[8:16]) | 1
+
+	var positions [bloomHashes]uint64
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % size
+	}
+
+	return positions
+}
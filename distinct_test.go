@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_Distinct(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>a</name></item>
+	<item><id>2</id><name>b</name></item>
+	<item><id>1</id><name>a</name></item>
+	<item><id>1</id></item>
+	<item><id>1</id><name></name></item>
+	<item><id>1</id></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"distinct": {},
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id"
+			},
+			{
+				"header": "name",
+				"valuePath": "/name"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// 存在しない値と空文字は区別される
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id,name",
+		"1,a",
+		"2,b",
+		"1,",
+		"1,",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Distinct_KeysLast(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "input")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	createFile(t, inputDir, "1.xml", `<root>
+	<item><id>1</id><name>a1</name></item>
+	<item><id>2</id><name>b1</name></item>
+	</root>`)
+	createFile(t, inputDir, "2.xml", `<root>
+	<item><id>3</id><name>c2</name></item>
+	<item><id>1</id><name>a2</name></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.yaml", `
+rowsPath: //item
+distinct:
+  keys: [id]
+  keep: last
+columns:
+  - header: id
+    valuePath: /id
+  - header: name
+    valuePath: /name
+`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputDir,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// 最後の行が、その行の位置で出力される
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id,name",
+		"2,b1",
+		"3,c2",
+		"1,a2",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Distinct_Spill(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	original := distinctMemoryEntries
+	distinctMemoryEntries = 2
+	t.Cleanup(func() { distinctMemoryEntries = original })
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id></item>
+	<item><id>2</id></item>
+	<item><id>3</id></item>
+	<item><id>1</id></item>
+	<item><id>4</id></item>
+	<item><id>5</id></item>
+	<item><id>3</id></item>
+	<item><id>5</id></item>
+	<item><id>2</id></item>
+	</root>`)
+
+	outputFirstPath := filepath.Join(temp, "first.csv")
+	outputLastPath := filepath.Join(temp, "last.csv")
+
+	for _, keep := range []string{"first", "last"} {
+		mappingPath := createFile(t, temp, keep+".json", fmt.Sprintf(`
+		{
+			"rowsPath": "//item",
+			"distinct": {"keys": ["id"], "keep": "%s"},
+			"columns": [
+				{
+					"header": "id",
+					"valuePath": "/id"
+				}
+			]
+		}`, keep))
+
+		out := new(bytes.Buffer)
+
+		// ACT
+		exitCode := run(
+			[]string{
+				"-i", inputPath,
+				"-m", mappingPath,
+				"-o", filepath.Join(temp, keep+".csv"),
+			},
+			out,
+		)
+
+		// ASSERT
+		require.Equal(t, OK, exitCode)
+		require.Empty(t, out.String())
+	}
+
+	assert.Equal(t, joinRows("id", "1", "2", "3", "4", "5"), readString(t, outputFirstPath))
+	assert.Equal(t, joinRows("id", "1", "4", "3", "5", "2"), readString(t, outputLastPath))
+}
+
+func TestRun_InvalidDistinct(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		distinct string
+		expect   string
+	}{
+		{
+			name:     "keep",
+			distinct: `{"keep": "any"}`,
+			expect:   "invalid mapping: distinct keep must be one of first, last\n",
+		},
+		{
+			name:     "keys",
+			distinct: `{"keys": ["id"]}`,
+			expect:   "invalid mapping: distinct key 'id' is not a header of the columns\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+
+			mappingPath := createFile(t, temp, "mapping.json", fmt.Sprintf(`
+			{
+				"rowsPath": "//item",
+				"distinct": %s,
+				"columns": [
+					{
+						"header": "title",
+						"valuePath": "/title"
+					}
+				]
+			}`, tt.distinct))
+
+			out := new(bytes.Buffer)
+
+			// ACT
+			exitCode := run(
+				[]string{
+					"-i", "testdata/rss.xml",
+					"-m", mappingPath,
+					"-o", filepath.Join(temp, "output.csv"),
+				},
+				out,
+			)
+
+			// ASSERT
+			require.Equal(t, NG, exitCode)
+			assert.Equal(t, tt.expect, out.String())
+		})
+	}
+}
+
+func TestEncodeRow(t *testing.T) {
+
+	// ARRANGE
+	a := "a"
+	empty := ""
+	multibyte := "あい,\"う\"\n"
+	values := []*string{&a, nil, &empty, &multibyte}
+
+	// ACT
+	result, err := decodeRow(encodeRow(values))
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, values, result)
+}
+
+func TestDecodeRow_Broken(t *testing.T) {
+
+	a := "abc"
+	encoded := encodeRow([]*string{&a})
+
+	_, err := decodeRow(encoded[:len(encoded)-1])
+	assert.EqualError(t, err, "spooled row is broken")
+}
+
+func TestHashSet(t *testing.T) {
+
+	// ARRANGE
+	original := distinctMergeFanIn
+	distinctMergeFanIn = 2
+	t.Cleanup(func() { distinctMergeFanIn = original })
+
+	set := newHashSet(3)
+	defer set.remove()
+
+	// ACT/ASSERT
+	for i := 0; i < 10; i++ {
+		added, err := set.add(sha256.Sum256([]byte(fmt.Sprint(i))))
+		require.NoError(t, err)
+		assert.True(t, added)
+	}
+	for i := 9; i >= 0; i-- {
+		added, err := set.add(sha256.Sum256([]byte(fmt.Sprint(i))))
+		require.NoError(t, err)
+		assert.False(t, added)
+	}
+
+	// 2つ目の退避でマージ
+	require.Len(t, set.runs, 2)
+	assert.Equal(t, int64(6), set.runs[0].count)
+	assert.Equal(t, 1, set.runs[0].level)
+	assert.Equal(t, int64(3), set.runs[1].count)
+	assert.Equal(t, 0, set.runs[1].level)
+	assert.Len(t, set.memory, 1)
+}
+
+func TestHashSet_Blocks(t *testing.T) {
+
+	// ARRANGE
+	original := distinctMergeFanIn
+	distinctMergeFanIn = 3
+	t.Cleanup(func() { distinctMergeFanIn = original })
+
+	// 複数のブロックを持つ退避ファイルを作る
+	set := newHashSet(300)
+	defer set.remove()
+
+	hash := func(i int) rowHash { return sha256.Sum256([]byte(fmt.Sprint(i))) }
+
+	// ACT/ASSERT
+	for i := 0; i < 5000; i++ {
+		added, err := set.add(hash(i))
+		require.NoError(t, err)
+		require.True(t, added, i)
+	}
+	for i := 0; i < 5000; i++ {
+		added, err := set.add(hash(i))
+		require.NoError(t, err)
+		require.False(t, added, i)
+	}
+	for i := 5000; i < 6000; i++ {
+		added, err := set.add(hash(i))
+		require.NoError(t, err)
+		require.True(t, added, i)
+	}
+
+	// 同じ階層の退避ファイルはdistinctMergeFanIn未満
+	levels := map[int]int{}
+	for _, run := range set.runs {
+		levels[run.level]++
+	}
+	for _, count := range levels {
+		assert.Less(t, count, 3)
+	}
+}
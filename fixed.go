@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+const (
+	AlignLeft  = "left"
+	AlignRight = "right"
+)
+
+const (
+	OverflowError    = "error"
+	OverflowTruncate = "truncate"
+	OverflowEllipsis = "ellipsis"
+)
+
+// ellipsis 省略した場合に末尾に付与する文字列
+const ellipsis = "..."
+
+// fixedWidthRowWriter カラムごとの幅(表示幅)に揃えて出力
+type fixedWidthRowWriter struct {
+	writer          *bufio.Writer
+	columns         []Column
+	nullValue       string
+	recordSeparator string
+}
+
+// validateFixedWidthColumn checks the align, the pad and the overflow of the column.
+func validateFixedWidthColumn(column Column) error {
+
+	if column.Width < 0 {
+		return fmt.Errorf("width must be 0 or more")
+	}
+
+	switch column.Align {
+	case "", AlignLeft, AlignRight:
+	default:
+		return fmt.Errorf("align must be one of left, right")
+	}
+
+	if column.Pad != "" && (len([]rune(column.Pad)) != 1 || displayWidth(column.Pad) != 1) {
+		return fmt.Errorf("pad must be a single-width character")
+	}
+
+	switch column.Overflow {
+	case "", OverflowError, OverflowTruncate, OverflowEllipsis:
+	default:
+		return fmt.Errorf("overflow must be one of error, truncate, ellipsis")
+	}
+
+	return nil
+}
+
+// validateFixedWidth checks that the mapping can be output as fixed-width.
+func validateFixedWidth(mapping *Mapping) error {
+
+	if mapping.isAggregation() {
+		return fmt.Errorf("fixed-width output cannot be used with aggregation")
+	}
+
+	for _, column := range mapping.Columns {
+		if column.Width == 0 {
+			return fmt.Errorf("column '%s' width is required for fixed-width output", column.Header)
+		}
+	}
+
+	return nil
+}
+
+func newFixedWidthRowWriter(writer io.Writer, format Format) *fixedWidthRowWriter {
+
+	recordSeparator := format.LineEnding
+	if recordSeparator == "" {
+		recordSeparator = "\r\n"
+	}
+
+	return &fixedWidthRowWriter{
+		writer:          bufio.NewWriter(writer),
+		columns:         format.FixedColumns,
+		nullValue:       format.NullValue,
+		recordSeparator: recordSeparator,
+	}
+}
+
+func (w *fixedWidthRowWriter) Write(values []*string) error {
+
+	var line strings.Builder
+	for i, value := range values {
+		field := w.nullValue
+		if value != nil {
+			field = *value
+		}
+
+		fitted, err := fitWidth(field, w.columns[i])
+		if err != nil {
+			return err
+		}
+		line.WriteString(fitted)
+	}
+	line.WriteString(w.recordSeparator)
+
+	_, err := w.writer.WriteString(line.String())
+	return err
+}
+
+func (w *fixedWidthRowWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+// fitWidth pads the value to the width of the column, or shortens it according to the overflow.
+func fitWidth(value string, column Column) (string, error) {
+
+	// 改行やタブなどは幅を決められず、行の区切りも崩れるため出力しない
+	if strings.ContainsFunc(value, unicode.IsControl) {
+		return "", fmt.Errorf("column '%s': %q contains a control character", column.Header, value)
+	}
+
+	valueWidth := displayWidth(value)
+	if valueWidth > column.Width {
+		switch column.Overflow {
+		case OverflowTruncate:
+			value, valueWidth = truncateWidth(value, column.Width)
+		case OverflowEllipsis:
+			if column.Width > len(ellipsis) {
+				value, valueWidth = truncateWidth(value, column.Width-len(ellipsis))
+				value += ellipsis
+				valueWidth += len(ellipsis)
+			} else {
+				value, valueWidth = truncateWidth(value, column.Width)
+			}
+		default:
+			return "", fmt.Errorf("column '%s': '%s' is wider than %d", column.Header, value, column.Width)
+		}
+	}
+
+	pad := column.Pad
+	if pad == "" {
+		pad = " "
+	}
+	padding := strings.Repeat(pad, column.Width-valueWidth)
+
+	if column.Align == AlignRight {
+		return padding + value, nil
+	}
+	return value + padding, nil
+}
+
+// truncateWidth cuts the value to at most the width, and returns it with its width.
+// A wide character which does not fit is removed entirely.
+func truncateWidth(value string, maxWidth int) (string, int) {
+
+	total := 0
+	for i, r := range value {
+		runeWidth := displayWidthOf(r)
+		if total+runeWidth > maxWidth {
+			return value[:i], total
+		}
+		total += runeWidth
+	}
+
+	return value, total
+}
+
+// displayWidth returns the display width of the value, counting East Asian wide characters as 2.
+func displayWidth(value string) int {
+
+	total := 0
+	for _, r := range value {
+		total += displayWidthOf(r)
+	}
+
+	return total
+}
+
+func displayWidthOf(r rune) int {
+
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	default:
+		// 曖昧な幅の文字は半角として扱う
+		return 1
+	}
+}
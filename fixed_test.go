@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_Fixed(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>apple</name><price>100</price></item>
+	<item><id>22</id><name>りんご</name><price>1500</price></item>
+	<item><id>333</id><name>パイナップル</name></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.yaml", `
+rowsPath: //item
+columns:
+  - header: id
+    valuePath: /id
+    width: 5
+    align: right
+    pad: "0"
+  - header: name
+    valuePath: /name
+    width: 10
+    overflow: ellipsis
+  - header: price
+    valuePath: /price
+    width: 6
+    align: right
+`)
+
+	outputPath := filepath.Join(temp, "output.txt")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+			"--output-format", "fixed",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// ヘッダは出力しない
+	expect := joinRows(
+		"00001apple        100",
+		"00022りんご      1500",
+		"00333パイナ...       ",
+	)
+	assert.Equal(t, expect, readString(t, outputPath))
+}
+
+func TestRun_Fixed_Overflow(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><name>abc</name></item>
+	<item><name>あいう</name></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{"header": "name", "valuePath": "/name", "width": 4}
+		]
+	}`)
+
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", filepath.Join(temp, "output.txt"),
+			"--output-format", "fixed",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := inputPath + " is failed: row 2: column 'name': 'あいう' is wider than 4\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_Fixed_ControlCharacter(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", "<root><item><a>x\ny</a></item></root>")
+	outputPath := filepath.Join(temp, "output.txt")
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{"header": "a", "valuePath": "/a", "width": 5}
+		]
+	}`)
+
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+			"--output-format", "fixed",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := inputPath + ` is failed: row 1: column 'a': "x\ny" contains a control character` + "\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_Fixed_Invalid(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		mapping string
+		expect  string
+	}{
+		{
+			name:    "width",
+			mapping: `{"rowsPath": "//item", "columns": [{"header": "title", "valuePath": "/title"}]}`,
+			expect:  "Invalid fixed-width specification: column 'title' width is required for fixed-width output\n",
+		},
+		{
+			name: "aggregation",
+			mapping: `{"rowsPath": "//item", "columns": [{"header": "title", "valuePath": "/title", "width": 10}],
+				"aggregates": [{"header": "count", "function": "count"}]}`,
+			expect: "Invalid fixed-width specification: fixed-width output cannot be used with aggregation\n",
+		},
+		{
+			name:    "align",
+			mapping: `{"rowsPath": "//item", "columns": [{"header": "title", "valuePath": "/title", "width": 10, "align": "center"}]}`,
+			expect:  "invalid mapping: column 'title' align must be one of left, right\n",
+		},
+		{
+			name:    "pad",
+			mapping: `{"rowsPath": "//item", "columns": [{"header": "title", "valuePath": "/title", "width": 10, "pad": "　"}]}`,
+			expect:  "invalid mapping: column 'title' pad must be a single-width character\n",
+		},
+		{
+			name:    "overflow",
+			mapping: `{"rowsPath": "//item", "columns": [{"header": "title", "valuePath": "/title", "width": 10, "overflow": "wrap"}]}`,
+			expect:  "invalid mapping: column 'title' overflow must be one of error, truncate, ellipsis\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			mappingPath := createFile(t, temp, "mapping.json", tt.mapping)
+			out := new(bytes.Buffer)
+
+			// ACT
+			exitCode := run(
+				[]string{
+					"-i", "testdata/rss.xml",
+					"-m", mappingPath,
+					"-o", filepath.Join(temp, "output.txt"),
+					"--output-format", "fixed",
+				},
+				out,
+			)
+
+			// ASSERT
+			require.Equal(t, NG, exitCode)
+			assert.Equal(t, tt.expect, out.String())
+		})
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		value  string
+		column Column
+		expect string
+	}{
+		{
+			name:   "left",
+			value:  "ab",
+			column: Column{Width: 5},
+			expect: "ab   ",
+		},
+		{
+			name:   "right",
+			value:  "ab",
+			column: Column{Width: 5, Align: AlignRight, Pad: "*"},
+			expect: "***ab",
+		},
+		{
+			name:   "wide",
+			value:  "日本",
+			column: Column{Width: 5},
+			expect: "日本 ",
+		},
+		{
+			name:   "halfwidth katakana",
+			value:  "ｶﾅ",
+			column: Column{Width: 3},
+			expect: "ｶﾅ ",
+		},
+		{
+			name:   "exact",
+			value:  "日本",
+			column: Column{Width: 4},
+			expect: "日本",
+		},
+		{
+			name:   "truncate",
+			value:  "abcdef",
+			column: Column{Width: 4, Overflow: OverflowTruncate},
+			expect: "abcd",
+		},
+		{
+			name:   "truncate wide",
+			value:  "日本語",
+			column: Column{Width: 5, Overflow: OverflowTruncate},
+			expect: "日本 ",
+		},
+		{
+			name:   "truncate wide right",
+			value:  "日本語",
+			column: Column{Width: 5, Align: AlignRight, Overflow: OverflowTruncate},
+			expect: " 日本",
+		},
+		{
+			name:   "ellipsis",
+			value:  "abcdefgh",
+			column: Column{Width: 6, Overflow: OverflowEllipsis},
+			expect: "abc...",
+		},
+		{
+			name:   "ellipsis wide",
+			value:  "日本語テキスト",
+			column: Column{Width: 8, Overflow: OverflowEllipsis},
+			expect: "日本... ",
+		},
+		{
+			name:   "ellipsis narrow",
+			value:  "abcdef",
+			column: Column{Width: 3, Overflow: OverflowEllipsis},
+			expect: "abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ACT
+			result, err := fitWidth(tt.value, tt.column)
+
+			// ASSERT
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, result)
+			assert.Equal(t, tt.column.Width, displayWidth(result))
+		})
+	}
+}
+
+func TestFitWidth_Error(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		value  string
+		column Column
+		expect string
+	}{
+		{
+			name:   "wider",
+			value:  "日本語",
+			column: Column{Header: "name", Width: 5},
+			expect: "column 'name': '日本語' is wider than 5",
+		},
+		{
+			name:   "newline",
+			value:  "x\ny",
+			column: Column{Header: "name", Width: 5},
+			expect: `column 'name': "x\ny" contains a control character`,
+		},
+		{
+			name:   "tab with truncate",
+			value:  "x\ty",
+			column: Column{Header: "name", Width: 1, Overflow: OverflowTruncate},
+			expect: `column 'name': "x\ty" contains a control character`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ACT
+			_, err := fitWidth(tt.value, tt.column)
+
+			// ASSERT
+			require.EqualError(t, err, tt.expect)
+		})
+	}
+}
@@ -5,21 +5,26 @@ go 1.24
 toolchain go1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/antchfx/htmlquery v1.3.6
+	github.com/antchfx/jsonquery v1.3.7
 	github.com/antchfx/xmlquery v1.4.0
-	github.com/antchfx/xpath v1.3.0
+	github.com/antchfx/xpath v1.3.6
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/onozaty/go-customcsv v1.0.1
 	github.com/spf13/pflag v1.0.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
 
 require (
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
-	github.com/stretchr/testify v1.8.1
-	golang.org/x/net v0.26.0 // indirect
-	golang.org/x/text v0.16.0 // indirect
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/net v0.33.0
+	golang.org/x/text v0.21.0
 )
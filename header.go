@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	HeaderCaseSnake = "snake"
+	HeaderCaseUpper = "upper"
+	HeaderCaseLower = "lower"
+)
+
+func parseHeaderCase(value string) (string, error) {
+
+	switch strings.ToLower(value) {
+	case "":
+		return "", nil
+	case HeaderCaseSnake:
+		return HeaderCaseSnake, nil
+	case HeaderCaseUpper:
+		return HeaderCaseUpper, nil
+	case HeaderCaseLower:
+		return HeaderCaseLower, nil
+	}
+
+	return "", fmt.Errorf("header case must be one of snake, upper, lower")
+}
+
+// formatHeaders converts the case of the headers and adds the prefix for the output.
+func formatHeaders(headers []string, format Format) []string {
+
+	if format.HeaderCase == "" && format.HeaderPrefix == "" {
+		return headers
+	}
+
+	formatted := make([]string, len(headers))
+	for i, header := range headers {
+		switch format.HeaderCase {
+		case HeaderCaseSnake:
+			header = toSnakeCase(header)
+		case HeaderCaseUpper:
+			header = strings.ToUpper(header)
+		case HeaderCaseLower:
+			header = strings.ToLower(header)
+		}
+
+		formatted[i] = format.HeaderPrefix + header
+	}
+
+	return formatted
+}
+
+// toSnakeCase converts the header such as 'orderId', 'Order ID' or 'HTTPStatus' to snake case.
+func toSnakeCase(header string) string {
+
+	runes := []rune(header)
+
+	var words []string
+	var word []rune
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			// 記号や空白は単語の区切り
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = nil
+			}
+			continue
+		}
+
+		// 小文字(数字)から大文字、もしくは大文字の連続の最後(HTTPStatusのS)で区切る
+		if unicode.IsUpper(r) && len(word) > 0 {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextIsLower) {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+
+	return strings.Join(words, "_")
+}
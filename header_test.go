@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_NoHeader(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>a</name></item>
+	<item><id>2</id><name>b</name></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	arguments := []string{
+		"-i", inputPath,
+		"-r", "//item",
+		"-c", "id=/id",
+		"-c", "name=/name",
+		"-o", outputPath,
+		"--no-header",
+		"--append",
+	}
+
+	// ACT
+	// ヘッダの無いファイルにも追記できる
+	out := new(bytes.Buffer)
+	exitCode1 := run(arguments, out)
+	exitCode2 := run(arguments, out)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode1)
+	require.Equal(t, OK, exitCode2)
+	require.Empty(t, out.String())
+
+	expect := joinRows(
+		"1,a",
+		"2,b",
+		"1,a",
+		"2,b",
+	)
+	assert.Equal(t, expect, readString(t, outputPath))
+}
+
+func TestRun_HeaderCase(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>a</name></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "orderId=/id",
+			"-c", "Customer Name=/name",
+			"-o", outputPath,
+			"--header-case", "snake",
+			"--header-prefix", "order.",
+			"--sort-by", "orderId",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	expect := joinRows(
+		"order.order_id,order.customer_name",
+		"1,a",
+	)
+	assert.Equal(t, expect, readString(t, outputPath))
+}
+
+func TestRun_HeaderCase_JSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>a</name></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.json")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "name=/name",
+			"-o", outputPath,
+			"--header-case", "upper",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	expect := "[\n  {\"ID\": \"1\", \"NAME\": \"a\"}\n]\n"
+	assert.Equal(t, expect, readString(t, outputPath))
+}
+
+func TestRun_HeaderCase_Append(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id></item>
+	</root>`)
+
+	outputPath := createFile(t, temp, "output.csv", joinRows("ID", "0"))
+	out := new(bytes.Buffer)
+
+	// ACT
+	// 変換後のヘッダで既存のファイルと比較
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"--header-case", "upper",
+			"--append",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	assert.Equal(t, joinRows("ID", "0", "1"), readString(t, outputPath))
+}
+
+func TestRun_DescriptionRow(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>a</name><price>100</price></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.yaml", `
+rowsPath: //item
+columns:
+  - header: id
+    valuePath: /id
+    description: 商品ID
+  - header: name
+    valuePath: /name
+  - header: price
+    valuePath: /price
+    description: 価格(税込, 円)
+`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+			"--description-row",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	expect := joinRows(
+		"id,name,price",
+		`商品ID,,"価格(税込, 円)"`,
+		"1,a,100",
+	)
+	assert.Equal(t, expect, readString(t, outputPath))
+}
+
+func TestRun_DescriptionRow_Aggregation(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><category>A</category><price>100</price></item>
+	<item><category>A</category><price>200</price></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{"header": "category", "valuePath": "/category", "description": "Category"},
+			{"header": "price", "valuePath": "/price", "description": "Price"}
+		],
+		"groupBy": ["category"],
+		"aggregates": [
+			{"header": "price", "function": "sum", "column": "price"}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+			"--description-row",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// 集計結果には説明は無い
+	expect := joinRows(
+		"category,price",
+		"Category,",
+		"A,300",
+	)
+	assert.Equal(t, expect, readString(t, outputPath))
+}
+
+func TestRun_Header_Invalid(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		arguments []string
+		expect    string
+	}{
+		{
+			name:      "header-case",
+			arguments: []string{"-o", "output.csv", "--header-case", "camel"},
+			expect:    "Invalid header-case specification: header case must be one of snake, upper, lower\n",
+		},
+		{
+			name:      "no-header with JSON",
+			arguments: []string{"-o", "output.json", "--no-header"},
+			expect:    "Invalid header specification: --no-header and --description-row cannot be used with JSON output\n",
+		},
+		{
+			name:      "description-row with JSON",
+			arguments: []string{"-o", "output.csv", "--output-format", "json", "--description-row"},
+			expect:    "Invalid header specification: --no-header and --description-row cannot be used with JSON output\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			out := new(bytes.Buffer)
+
+			// ACT
+			exitCode := run(
+				append([]string{
+					"-i", "testdata/rss.xml",
+					"-m", "mapping/rss.json",
+				}, tt.arguments...),
+				out,
+			)
+
+			// ASSERT
+			require.Equal(t, NG, exitCode)
+			assert.Equal(t, tt.expect, out.String())
+		})
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+
+	tests := []struct {
+		header string
+		expect string
+	}{
+		{header: "id", expect: "id"},
+		{header: "orderId", expect: "order_id"},
+		{header: "OrderID", expect: "order_id"},
+		{header: "HTTPStatus", expect: "http_status"},
+		{header: "Customer Name", expect: "customer_name"},
+		{header: "customer-name", expect: "customer_name"},
+		{header: "  item__code  ", expect: "item_code"},
+		{header: "address1Line", expect: "address1_line"},
+		{header: "商品名", expect: "商品名"},
+		{header: "商品 ID", expect: "商品_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+
+			// ACT
+			result := toSnakeCase(tt.header)
+
+			// ASSERT
+			assert.Equal(t, tt.expect, result)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// convertTables converts every <table> in the HTML files to CSV files.
+// The n-th table is written to the file with '-n' appended to the output file name (e.g. output-1.csv).
+func convertTables(htmlPaths []string, csvPath string, format Format) error {
+
+	count := 0
+	for _, htmlPath := range htmlPaths {
+		tables, err := findTables(htmlPath)
+		if err != nil {
+			return err
+		}
+
+		for _, table := range tables {
+			count++
+			if err := writeTable(table, tablePath(csvPath, count), format); err != nil {
+				return err
+			}
+		}
+	}
+
+	if count == 0 {
+		return fmt.Errorf("table is not found")
+	}
+
+	return nil
+}
+
+func findTables(htmlPath string) ([]*html.Node, error) {
+
+	reader, err := open(htmlPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s is failed: %w", htmlPath, err)
+	}
+	defer reader.Close()
+
+	doc, err := htmlquery.Parse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s is failed: %w", htmlPath, err)
+	}
+
+	return htmlquery.Find(doc, "//table"), nil
+}
+
+func writeTable(table *html.Node, csvPath string, format Format) error {
+
+	csvFile, err := os.Create(csvPath)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+
+	csvWriter, err := newCSVWriter(csvFile, format)
+	if err != nil {
+		return err
+	}
+
+	// 入れ子になったテーブルの行は含めない
+	for _, tr := range htmlquery.Find(table, "./tr | ./thead/tr | ./tbody/tr | ./tfoot/tr") {
+		var values []string
+		for _, cell := range htmlquery.Find(tr, "./th | ./td") {
+			values = append(values, strings.TrimSpace(htmlquery.InnerText(cell)))
+		}
+
+		if err := csvWriter.Write(values); err != nil {
+			return err
+		}
+	}
+
+	return csvWriter.Flush()
+}
+
+func tablePath(csvPath string, number int) string {
+
+	ext := filepath.Ext(csvPath)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(csvPath, ext), number, ext)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// elementStat 要素(パス)ごとの出現状況
+type elementStat struct {
+	path  string
+	name  string
+	depth int
+	// repeated 同じ親の下で同じ名前の兄弟要素と共に出現した数
+	repeated   int
+	attributes []string
+	hasChild   bool
+}
+
+// xmlStructure XMLの構造(出現順を保持)
+type xmlStructure struct {
+	stats []*elementStat
+	index map[string]*elementStat
+}
+
+// openElement 読み込み中の要素と、その子要素の名前ごとの数
+type openElement struct {
+	stat     *elementStat
+	children map[*elementStat]int
+}
+
+func runInfer(arguments []string, output io.Writer) int {
+
+	var xmlPath string
+	var mappingPath string
+	var depth int
+	var noAttributes bool
+	var help bool
+
+	flagSet := flag.NewFlagSet("xml2csv infer", flag.ContinueOnError)
+
+	flagSet.StringVarP(&xmlPath, "input", "i", "", "Sample XML file path or url")
+	flagSet.StringVarP(&mappingPath, "output", "o", "", "(optional) Mapping output file path (default stdout)")
+	flagSet.IntVar(&depth, "depth", 1, "(optional) Depth of descendant elements to be columns")
+	flagSet.BoolVar(&noAttributes, "no-attributes", false, "(optional) Exclude attributes from columns")
+	flagSet.BoolVarP(&help, "help", "h", false, "Help")
+
+	flagSet.SortFlags = false
+	flagSet.Usage = func() {
+		fmt.Fprintf(output, "xml2csv v%s (%s)\n\n", Version, Commit)
+		fmt.Fprint(output, "Usage: xml2csv infer [flags]\n\nFlags\n")
+		flagSet.PrintDefaults()
+		fmt.Fprintln(output)
+	}
+	flagSet.SetOutput(output)
+
+	if err := flagSet.Parse(arguments); err != nil {
+		flagSet.Usage()
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	if help {
+		flagSet.Usage()
+		return OK
+	}
+
+	if xmlPath == "" || depth < 1 {
+		flagSet.Usage()
+		return NG
+	}
+
+	mapping, err := inferMapping(xmlPath, depth, !noAttributes)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	writer := output
+	if mappingPath != "" {
+		mappingFile, err := os.Create(mappingPath)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+		defer mappingFile.Close()
+
+		writer = mappingFile
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "    ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(mapping); err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	return OK
+}
+
+// inferMapping infers the mapping from the structure of the sample XML.
+func inferMapping(xmlPath string, depth int, includeAttributes bool) (*Mapping, error) {
+
+	reader, err := open(xmlPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	structure, err := scanStructure(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s is failed: %w", xmlPath, err)
+	}
+
+	row := structure.mostRepeated()
+	if row == nil {
+		return nil, fmt.Errorf("%s has no repeating element", xmlPath)
+	}
+
+	columns := newColumnBuilder()
+
+	if includeAttributes {
+		for _, attribute := range row.attributes {
+			columns.add(attribute, "/@"+attribute, "")
+		}
+	}
+
+	for _, stat := range structure.stats {
+		if !strings.HasPrefix(stat.path, row.path+"/") || stat.depth-row.depth > depth {
+			continue
+		}
+
+		relativePath := strings.TrimPrefix(stat.path, row.path)
+		header := headerOf(relativePath)
+
+		// 子要素を持つ要素は、指定の深さに達した場合のみ値として扱う
+		if !stat.hasChild || stat.depth-row.depth == depth {
+			columns.add(header, relativePath, "")
+		}
+
+		if includeAttributes {
+			for _, attribute := range stat.attributes {
+				columns.add(header+"_"+attribute, relativePath+"/@"+attribute, "")
+			}
+		}
+	}
+
+	return &Mapping{
+		RowsPath: structure.rowsPath(row),
+		Columns:  columns.columns,
+	}, nil
+}
+
+// columnBuilder 生成するマッピングのカラム(ヘッダの重複を避ける)
+type columnBuilder struct {
+	columns []Column
+	headers map[string]bool
+}
+
+func newColumnBuilder() *columnBuilder {
+	return &columnBuilder{headers: map[string]bool{}}
+}
+
+func (b *columnBuilder) add(header string, valuePath string, columnType string) {
+
+	// ヘッダが重複する場合は、他のヘッダ(元から連番の付いたものを含む)と重複しない連番を付与
+	if b.headers[header] {
+		for number := 2; ; number++ {
+			numbered := fmt.Sprintf("%s_%d", header, number)
+			if !b.headers[numbered] {
+				header = numbered
+				break
+			}
+		}
+	}
+	b.headers[header] = true
+
+	b.columns = append(b.columns, Column{Header: header, ValuePath: valuePath, Type: columnType})
+}
+
+// headerOf returns the header for the relative path (e.g. '/author/name' -> 'author_name').
+func headerOf(relativePath string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(relativePath, "/"), "/", "_")
+}
+
+func scanStructure(reader io.Reader) (*xmlStructure, error) {
+
+	structure := &xmlStructure{index: map[string]*elementStat{}}
+	decoder := xml.NewDecoder(reader)
+
+	var stack []*openElement
+	for {
+		// 名前空間のプレフィックスをそのまま扱うためRawTokenで読み込む
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := qualifiedName(t.Name)
+
+			parentPath := ""
+			var parent *openElement
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+				parent.stat.hasChild = true
+				parentPath = parent.stat.path
+			}
+
+			stat := structure.get(parentPath+"/"+name, name, len(stack)+1)
+			if parent != nil {
+				parent.children[stat]++
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue
+				}
+				stat.addAttribute(qualifiedName(attr.Name))
+			}
+
+			stack = append(stack, &openElement{stat: stat, children: map[*elementStat]int{}})
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected end element </%s>", qualifiedName(t.Name))
+			}
+
+			// 親ごとに兄弟要素として繰り返された数を集計
+			for child, count := range stack[len(stack)-1].children {
+				if count > 1 {
+					child.repeated += count
+				}
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	return structure, nil
+}
+
+func (s *xmlStructure) get(path string, name string, depth int) *elementStat {
+
+	stat, found := s.index[path]
+	if !found {
+		stat = &elementStat{path: path, name: name, depth: depth}
+		s.index[path] = stat
+		s.stats = append(s.stats, stat)
+	}
+
+	return stat
+}
+
+// mostRepeated returns the element which is repeated most as siblings under the same parent, and has children or attributes.
+// Elements which appear many times in the document but once per parent are not repeated.
+// If there are multiple candidates, the shallower one (appeared earlier) is selected.
+func (s *xmlStructure) mostRepeated() *elementStat {
+
+	var found *elementStat
+	for _, stat := range s.stats {
+		if stat.repeated < 2 || (!stat.hasChild && len(stat.attributes) == 0) {
+			continue
+		}
+
+		if found == nil || stat.repeated > found.repeated || (stat.repeated == found.repeated && stat.depth < found.depth) {
+			found = stat
+		}
+	}
+
+	return found
+}
+
+// rowsPath returns '//name' if the name is unique in the structure, otherwise the absolute path.
+func (s *xmlStructure) rowsPath(row *elementStat) string {
+
+	for _, stat := range s.stats {
+		if stat != row && stat.name == row.name {
+			return row.path
+		}
+	}
+
+	return "//" + row.name
+}
+
+func (e *elementStat) addAttribute(name string) {
+
+	for _, attribute := range e.attributes {
+		if attribute == name {
+			return
+		}
+	}
+
+	e.attributes = append(e.attributes, name)
+}
+
+func qualifiedName(name xml.Name) string {
+
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunInfer(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"infer",
+			"-i", "testdata/rss.xml",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	expect := `{
+    "rowsPath": "//item",
+    "columns": [
+        {
+            "header": "title",
+            "valuePath": "/title"
+        },
+        {
+            "header": "link",
+            "valuePath": "/link"
+        },
+        {
+            "header": "description",
+            "valuePath": "/description"
+        }
+    ]
+}
+`
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRunInfer_OutputFile(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mappingPath := filepath.Join(temp, "mapping.json")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"init",
+			"-i", "testdata/junit/TestCase2.xml",
+			"-o", mappingPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result, err := loadMapping(mappingPath)
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//testcase",
+		Columns: []Column{
+			{Header: "name", ValuePath: "/@name"},
+			{Header: "classname", ValuePath: "/@classname"},
+			{Header: "time", ValuePath: "/@time"},
+		},
+	}
+	assert.Equal(t, expect, result)
+
+	// 生成したマッピングで変換できること
+	outputPath := filepath.Join(temp, "output.csv")
+	exitCode = run(
+		[]string{
+			"-i", "testdata/junit/TestCase2.xml",
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+	require.Equal(t, OK, exitCode)
+
+	assert.Equal(t,
+		joinRows(
+			"name,classname,time",
+			"test1,com.github.onozaty.junit.xml2csv.TestCase2,0.001",
+			"test2,com.github.onozaty.junit.xml2csv.TestCase2,0.002",
+		),
+		readString(t, outputPath))
+}
+
+func TestRunInfer_NoneInput(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"infer",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Contains(t, out.String(), "Usage: xml2csv infer [flags]")
+}
+
+func TestInferMapping_Depth(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item id="1">
+		<name>name1</name>
+		<author><name>a</name><mail type="work">a@example.com</mail></author>
+	</item>
+	<item id="2">
+		<name>name2</name>
+		<author><name>b</name></author>
+	</item>
+	<other/>
+	</root>`)
+
+	// ACT
+	result, err := inferMapping(inputPath, 2, true)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//item",
+		Columns: []Column{
+			{Header: "id", ValuePath: "/@id"},
+			{Header: "name", ValuePath: "/name"},
+			{Header: "author_name", ValuePath: "/author/name"},
+			{Header: "author_mail", ValuePath: "/author/mail"},
+			{Header: "author_mail_type", ValuePath: "/author/mail/@type"},
+		},
+	}
+	assert.Equal(t, expect, result)
+}
+
+func TestInferMapping_NoAttributes(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item id="1">
+		<name>name1</name>
+		<author><name>a</name></author>
+	</item>
+	<item id="2">
+		<name>name2</name>
+	</item>
+	</root>`)
+
+	// ACT
+	result, err := inferMapping(inputPath, 1, false)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//item",
+		Columns: []Column{
+			{Header: "name", ValuePath: "/name"},
+			{Header: "author", ValuePath: "/author"},
+		},
+	}
+	assert.Equal(t, expect, result)
+}
+
+func TestInferMapping_SameNameInOtherPath(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<items>
+		<item><name>1</name></item>
+		<item><name>2</name></item>
+		<item><name>3</name></item>
+	</items>
+	<meta><item>x</item></meta>
+	</root>`)
+
+	// ACT
+	result, err := inferMapping(inputPath, 1, true)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "/root/items/item",
+		Columns: []Column{
+			{Header: "name", ValuePath: "/name"},
+		},
+	}
+	assert.Equal(t, expect, result)
+}
+
+func TestInferMapping_RepeatedPerParent(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// detailは文書全体では最も多いが、親ごとには1つのみ
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<order><id>1</id><detail><code>a</code></detail></order>
+	<order><id>2</id><detail><code>b</code></detail></order>
+	<order><id>3</id><detail><code>c</code></detail></order>
+	<order><id>4</id><detail><code>d</code></detail></order>
+	<info><detail><code>x</code></detail><detail><code>y</code></detail></info>
+	</root>`)
+
+	// ACT
+	result, err := inferMapping(inputPath, 1, true)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, "//order", result.RowsPath)
+}
+
+func TestInferMapping_NumberedHeader(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item x="1"><x>a</x><x_2>b</x_2></item>
+	<item x="2"><x>c</x><x_2>d</x_2></item>
+	</root>`)
+
+	// ACT
+	result, err := inferMapping(inputPath, 1, true)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 連番が元からあるヘッダと重複しない
+	expect := []Column{
+		{Header: "x", ValuePath: "/@x"},
+		{Header: "x_2", ValuePath: "/x"},
+		{Header: "x_2_2", ValuePath: "/x_2"},
+	}
+	assert.Equal(t, expect, result.Columns)
+}
+
+func TestInferMapping_NoRepeating(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root><item><name>1</name></item></root>`)
+
+	// ACT
+	_, err := inferMapping(inputPath, 1, true)
+
+	// ASSERT
+	require.EqualError(t, err, inputPath+" has no repeating element")
+}
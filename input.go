@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/jsonquery"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+// InputFormat 入力ファイルの形式
+type InputFormat string
+
+const (
+	InputFormatAuto InputFormat = ""
+	InputFormatXML  InputFormat = "xml"
+	InputFormatJSON InputFormat = "json"
+	InputFormatHTML InputFormat = "html"
+)
+
+// rowReader 入力から rowsPath に該当するノードを順に読み込む
+type rowReader interface {
+	Read() (xpath.NodeNavigator, error)
+}
+
+type xmlRowReader struct {
+	parser *xmlquery.StreamParser
+}
+
+type jsonRowReader struct {
+	rows []*jsonquery.Node
+}
+
+type htmlRowReader struct {
+	rows []*html.Node
+}
+
+func parseInputFormat(value string) (InputFormat, error) {
+
+	switch InputFormat(strings.ToLower(value)) {
+	case InputFormatAuto:
+		return InputFormatAuto, nil
+	case InputFormatXML:
+		return InputFormatXML, nil
+	case InputFormatJSON:
+		return InputFormatJSON, nil
+	case InputFormatHTML:
+		return InputFormatHTML, nil
+	}
+
+	return "", fmt.Errorf("input format must be one of xml, json, html")
+}
+
+// resolveInputFormat returns the specified format, or determines it from the extension.
+func resolveInputFormat(path string, inputFormat InputFormat) InputFormat {
+
+	if inputFormat != InputFormatAuto {
+		return inputFormat
+	}
+
+	switch extension(path) {
+	case ".json":
+		return InputFormatJSON
+	case ".html", ".htm":
+		return InputFormatHTML
+	}
+
+	return InputFormatXML
+}
+
+func newRowReader(reader io.Reader, path string, inputFormat InputFormat, rowsPath string) (rowReader, error) {
+
+	switch inputFormat {
+	case InputFormatJSON:
+		return newJSONRowReader(reader, path, rowsPath)
+	case InputFormatHTML:
+		return newHTMLRowReader(reader, path, rowsPath)
+	default:
+		return newXMLRowReader(reader, rowsPath)
+	}
+}
+
+func newXMLRowReader(reader io.Reader, rowsPath string) (*xmlRowReader, error) {
+
+	parser, err := xmlquery.CreateStreamParser(reader, rowsPath)
+	if err != nil {
+		return nil, fmt.Errorf("xpath '%s' is failed: %w", rowsPath, err)
+	}
+
+	return &xmlRowReader{parser: parser}, nil
+}
+
+func (r *xmlRowReader) Read() (xpath.NodeNavigator, error) {
+
+	row, err := r.parser.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	return xmlquery.CreateXPathNavigator(row), nil
+}
+
+func newJSONRowReader(reader io.Reader, path string, rowsPath string) (*jsonRowReader, error) {
+
+	// JSONはストリームでの読み込みができないため、全体を読み込んでから行を取得
+	doc, err := jsonquery.Parse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s is failed: %w", path, err)
+	}
+
+	rows, err := jsonquery.QueryAll(doc, rowsPath)
+	if err != nil {
+		return nil, fmt.Errorf("xpath '%s' is failed: %w", rowsPath, err)
+	}
+
+	return &jsonRowReader{rows: rows}, nil
+}
+
+func (r *jsonRowReader) Read() (xpath.NodeNavigator, error) {
+
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+
+	return jsonquery.CreateXPathNavigator(row), nil
+}
+
+func newHTMLRowReader(reader io.Reader, path string, rowsPath string) (*htmlRowReader, error) {
+
+	// 整形式でないHTMLも扱えるように、HTML5のパーサで全体を読み込んでから行を取得
+	doc, err := htmlquery.Parse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s is failed: %w", path, err)
+	}
+
+	rows, err := htmlquery.QueryAll(doc, rowsPath)
+	if err != nil {
+		return nil, fmt.Errorf("xpath '%s' is failed: %w", rowsPath, err)
+	}
+
+	return &htmlRowReader{rows: rows}, nil
+}
+
+func (r *htmlRowReader) Read() (xpath.NodeNavigator, error) {
+
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+
+	return htmlquery.CreateXPathNavigator(row), nil
+}
+
+// innerText returns the text of the node where the navigator points.
+func innerText(navigator xpath.NodeNavigator) string {
+
+	if xmlNavigator, ok := navigator.(*xmlquery.NodeNavigator); ok && navigator.NodeType() != xpath.AttributeNode {
+		// CDATAなども含めたテキストとする
+		return xmlNavigator.Current().InnerText()
+	}
+
+	return navigator.Value()
+}
+
+// extension returns the lower-cased extension of the file path or url.
+func extension(path string) string {
+
+	if isURL(path) {
+		// クエリ文字列などは拡張子の判定から除外
+		if u, err := url.Parse(path); err == nil {
+			path = u.Path
+		}
+	}
+
+	return strings.ToLower(filepath.Ext(path))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveInputFormat(t *testing.T) {
+
+	assert.Equal(t, InputFormatXML, resolveInputFormat("input.xml", InputFormatAuto))
+	assert.Equal(t, InputFormatXML, resolveInputFormat("input", InputFormatAuto))
+	assert.Equal(t, InputFormatJSON, resolveInputFormat("input.JSON", InputFormatAuto))
+	assert.Equal(t, InputFormatJSON, resolveInputFormat("https://example.com/input.json?page=1", InputFormatAuto))
+	assert.Equal(t, InputFormatHTML, resolveInputFormat("input.html", InputFormatAuto))
+	assert.Equal(t, InputFormatHTML, resolveInputFormat("input.htm", InputFormatAuto))
+	assert.Equal(t, InputFormatXML, resolveInputFormat("input.json", InputFormatXML))
+	assert.Equal(t, InputFormatJSON, resolveInputFormat("input.xml", InputFormatJSON))
+}
+
+func TestParseInputFormat(t *testing.T) {
+
+	result, err := parseInputFormat("JSON")
+	assert.NoError(t, err)
+	assert.Equal(t, InputFormatJSON, result)
+
+	result, err = parseInputFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, InputFormatAuto, result)
+
+	_, err = parseInputFormat("yaml")
+	assert.EqualError(t, err, "input format must be one of xml, json, html")
+}
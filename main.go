@@ -1,20 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/onozaty/go-customcsv"
-
-	"github.com/antchfx/xmlquery"
+	"github.com/BurntSushi/toml"
 	"github.com/antchfx/xpath"
+	"gopkg.in/yaml.v3"
 
 	flag "github.com/spf13/pflag"
 )
@@ -26,25 +30,118 @@ var (
 
 // Column カラムの定義
 type Column struct {
-	Header      string `json:"header"`
-	ValuePath   string `json:"valuePath"`
-	UseEvaluate bool   `json:"useEvaluate"`
+	Header      string `json:"header" yaml:"header" toml:"header"`
+	ValuePath   string `json:"valuePath" yaml:"valuePath" toml:"valuePath"`
+	UseEvaluate bool   `json:"useEvaluate,omitempty" yaml:"useEvaluate" toml:"useEvaluate"`
+	// Type データ型(string, integer, number, boolean, date, datetime, time)
+	Type string `json:"type,omitempty" yaml:"type" toml:"type"`
+	// Transforms 値の変換(指定順に適用)
+	Transforms []Transform `json:"transforms,omitempty" yaml:"transforms" toml:"transforms"`
+	// Default 該当するノードが存在しない場合の値(空の要素の場合は使われない)
+	Default *string `json:"default,omitempty" yaml:"default" toml:"default"`
+	// Required 値が存在しない、もしくは空の場合に不正な行とする
+	Required bool `json:"required,omitempty" yaml:"required" toml:"required"`
+	// Constraints 値の制約(違反した場合に不正な行とする)
+	Constraints *Constraints `json:"constraints,omitempty" yaml:"constraints" toml:"constraints"`
+	// Description 説明(--description-rowでヘッダの次の行に出力)
+	Description string `json:"description,omitempty" yaml:"description" toml:"description"`
+	// Width 固定長で出力する場合の幅(全角文字は2として数える)
+	Width int `json:"width,omitempty" yaml:"width" toml:"width"`
+	// Align 固定長で出力する場合の寄せ(left, right、指定しない場合はleft)
+	Align string `json:"align,omitempty" yaml:"align" toml:"align"`
+	// Pad 固定長で出力する場合に埋める文字(指定しない場合は空白)
+	Pad string `json:"pad,omitempty" yaml:"pad" toml:"pad"`
+	// Overflow 幅を超える値の扱い(error, truncate, ellipsis、指定しない場合はerror)
+	Overflow string `json:"overflow,omitempty" yaml:"overflow" toml:"overflow"`
 }
 
 // Mapping マッピング情報
 type Mapping struct {
-	RowsPath string   `json:"rowsPath"`
-	Columns  []Column `json:"columns"`
+	RowsPath string `json:"rowsPath" yaml:"rowsPath" toml:"rowsPath"`
+	// Filter 行ごとに評価し、真となる行のみ出力する式
+	Filter  string   `json:"filter,omitempty" yaml:"filter" toml:"filter"`
+	Columns []Column `json:"columns" yaml:"columns" toml:"columns"`
+	// GroupBy 集計する場合にグループ化するカラムのヘッダ
+	GroupBy []string `json:"groupBy,omitempty" yaml:"groupBy" toml:"groupBy"`
+	// Aggregates 集計カラム(GroupByもしくはAggregatesを指定した場合は集計結果を出力)
+	Aggregates []Aggregate `json:"aggregates,omitempty" yaml:"aggregates" toml:"aggregates"`
+	// Distinct 重複する行の除外
+	Distinct *Distinct `json:"distinct,omitempty" yaml:"distinct" toml:"distinct"`
+	// NullValue 該当するノードが存在しない値のCSVでの出力
+	NullValue string `json:"nullValue,omitempty" yaml:"nullValue" toml:"nullValue"`
+	// OnInvalidRow 不正な行の扱い(error: エラーとして終了、skip: 行を出力しない)
+	OnInvalidRow string `json:"onInvalidRow,omitempty" yaml:"onInvalidRow" toml:"onInvalidRow"`
+}
+
+const (
+	OnInvalidRowError = "error"
+	OnInvalidRowSkip  = "skip"
+)
+
+// invalidRowError 行の値が不正であることを示すエラー(onInvalidRowに従って扱う)
+type invalidRowError struct {
+	message string
+}
+
+func (e *invalidRowError) Error() string {
+	return e.message
 }
 
+// MappingFormat マッピングファイルの形式
+type MappingFormat int
+
+const (
+	MappingFormatJSON MappingFormat = iota
+	MappingFormatYAML
+	MappingFormatTOML
+)
+
 const (
 	OK int = 0
 	NG int = 1
 )
 
+// コマンドラインでのカラム指定で、useEvaluateを指定するためのサフィックス
+const evalSuffix = "!eval"
+
+// columnTypes カラムのデータ型として指定できる値
+var columnTypes = []string{"string", "integer", "number", "boolean", "date", "datetime", "time"}
+
+var tomlKeyValuePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\s*=`)
+
 type Format struct {
 	Delimiter rune
-	WithBom   bool
+	// Quoting 値を囲む方法(指定しない場合はminimal)
+	Quoting QuoteStyle
+	// QuoteChar 囲み文字(指定しない場合は'"')
+	QuoteChar rune
+	// EscapeChar エスケープ文字(指定しない場合は囲み文字を重ねてエスケープ)
+	EscapeChar rune
+	// LineEnding 行の区切り(指定しない場合はCRLF)
+	LineEnding   string
+	WithBom      bool
+	InputFormat  InputFormat
+	OutputFormat OutputFormat
+	// NullValue 該当するノードが存在しない値の出力(JSONではnull)
+	NullValue string
+	// SortKeys 行の並び替えのキー(指定しない場合は入力の順序)
+	SortKeys []SortKey
+	// Split 出力ファイルの分割
+	Split Split
+	// WithoutHeader ヘッダを出力しない
+	WithoutHeader bool
+	// HeaderCase ヘッダの大文字小文字の変換(snake, upper, lower、指定しない場合は変換しない)
+	HeaderCase string
+	// HeaderPrefix ヘッダの先頭に付与する文字列
+	HeaderPrefix string
+	// Descriptions ヘッダの次の行に出力する説明(指定しない場合は出力しない)
+	Descriptions []string
+	// FixedColumns 固定長で出力する場合のカラムの幅などの定義
+	FixedColumns []Column
+	// Monitor 進捗と統計の記録(指定しない場合は記録しない)
+	Monitor *monitor
+	// Rejects onInvalidRowがskipの場合に読み飛ばした行のメッセージの出力先(指定しない場合は出力しない)
+	Rejects io.Writer
 }
 
 func main() {
@@ -54,10 +151,52 @@ func main() {
 
 func run(arguments []string, output io.Writer) int {
 
+	if len(arguments) > 0 {
+		switch arguments[0] {
+		case "infer", "init":
+			return runInfer(arguments[1:], output)
+		case "xsd":
+			return runXSD(arguments[1:], output)
+		case "csv2xml":
+			return runCSV2XML(arguments[1:], output)
+		case "watch":
+			return runWatch(arguments[1:], output)
+		case "serve":
+			return runServe(arguments[1:], output)
+		case "profile":
+			return runProfile(arguments[1:], output)
+		}
+	}
+
 	var xmlPath string
 	var mappingPath string
+	var rowsPath string
+	var where string
+	var columnSpecs []string
+	var sortSpecs []string
+	var splitRows int
+	var splitBytes string
+	var splitBy string
 	var csvPath string
+	var appendOutput bool
+	var statePath string
+	var schemaPath string
+	var onInvalidFile string
 	var withBom bool
+	var quote string
+	var quoteChar string
+	var escapeChar string
+	var lineEnding string
+	var inputFormat string
+	var outputFormat string
+	var nullValue string
+	var noHeader bool
+	var headerCase string
+	var headerPrefix string
+	var descriptionRow bool
+	var tables bool
+	var progress bool
+	var statsFormat string
 	// delimiter used for CSV output, default to comma (",")
 	var delimiter string
 	var help bool
@@ -65,10 +204,36 @@ func run(arguments []string, output io.Writer) int {
 	flagSet := flag.NewFlagSet("xml2csv", flag.ContinueOnError)
 
 	flagSet.StringVarP(&xmlPath, "input", "i", "", "XML input file path or directory or url")
+	flagSet.StringVar(&inputFormat, "input-format", "", "(optional) Input format (xml, json, html) (default determined by extension)")
 	flagSet.StringVarP(&mappingPath, "mapping", "m", "", "XML to CSV mapping file path or url")
+	flagSet.StringVarP(&rowsPath, "rows", "r", "", "(optional) XPath to get as a rows (overrides rowsPath in mapping)")
+	flagSet.StringVar(&where, "where", "", "(optional) XPath expression to filter rows (overrides filter in mapping)")
+	flagSet.StringArrayVarP(&columnSpecs, "column", "c", nil, "(optional) Column as 'header=valuePath' ('!eval' suffix for useEvaluate), repeatable")
+	flagSet.StringArrayVar(&sortSpecs, "sort-by", nil, "(optional) Sort rows by 'header[:desc][:numeric]', repeatable")
 	flagSet.StringVarP(&csvPath, "output", "o", "", "CSV output file path")
+	flagSet.BoolVar(&appendOutput, "append", false, "(optional) Append to the output file without the header if it exists")
+	flagSet.StringVar(&statePath, "state", "", "(optional) State file path to convert only new or changed files (requires --append)")
+	flagSet.StringVar(&schemaPath, "schema", "", "(optional) XSD file path or url to validate the inputs before conversion")
+	flagSet.StringVar(&onInvalidFile, "on-invalid-file", OnInvalidFileError, "(optional) Handling of the inputs invalid against the schema (error, skip)")
+	flagSet.IntVar(&splitRows, "split-rows", 0, "(optional) Split output into files of at most N rows")
+	flagSet.StringVar(&splitBytes, "split-bytes", "", "(optional) Split output into files of at most SIZE (e.g. '100MB')")
+	flagSet.StringVar(&splitBy, "split-by", "", "(optional) Split output into a file per value of the header")
+	flagSet.StringVar(&outputFormat, "output-format", "", "(optional) Output format (csv, json, fixed) (default determined by extension)")
 	flagSet.StringVarP(&delimiter, "delimiter", "d", ",", "(optional) CSV output delimiter (e.g. ';' or '\\t' for tab)")
 	flagSet.BoolVarP(&withBom, "bom", "b", false, "(optional) CSV with BOM")
+	flagSet.StringVar(&quote, "quote", string(QuoteMinimal), "(optional) CSV quoting (always, minimal, never, nonnumeric)")
+	flagSet.StringVar(&quoteChar, "quote-char", `"`, "(optional) CSV quote character")
+	flagSet.StringVar(&escapeChar, "escape-char", "", "(optional) CSV escape character instead of doubling the quote (e.g. '\\\\' for MySQL LOAD DATA)")
+	flagSet.StringVar(&lineEnding, "line-ending", LineEndingCRLF, "(optional) CSV line ending (crlf, lf)")
+	flagSet.StringVar(&nullValue, "null-value", "", "(optional) CSV output value for missing nodes (overrides nullValue in mapping) (e.g. '\\N')")
+	flagSet.BoolVar(&noHeader, "no-header", false, "(optional) Output without the header")
+	flagSet.StringVar(&headerCase, "header-case", "", "(optional) Convert the case of the header (snake, upper, lower)")
+	flagSet.StringVar(&headerPrefix, "header-prefix", "", "(optional) Prefix added to the header")
+	flagSet.BoolVar(&descriptionRow, "description-row", false, "(optional) Output the descriptions of the columns as the second header row")
+	flagSet.BoolVar(&tables, "tables", false, "(optional) Convert every <table> in HTML to CSV without mapping")
+	flagSet.BoolVar(&progress, "progress", false, "(optional) Show progress on stderr")
+	flagSet.StringVar(&statsFormat, "stats", "", "(optional) Print summary of the conversion ('--stats' or '--stats=json')")
+	flagSet.Lookup("stats").NoOptDefVal = StatsFormatText
 	flagSet.BoolVarP(&help, "help", "h", false, "Help")
 
 	flagSet.SortFlags = false
@@ -92,28 +257,141 @@ func run(arguments []string, output io.Writer) int {
 		return NG
 	}
 
+	quoting, err := parseQuoteStyle(quote)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid quote specification:", err)
+		return NG
+	}
+
+	quoteRune, err := getCharRune("quote character", quoteChar)
+	if err != nil || quoteRune == 0 {
+		fmt.Fprintln(output, "Invalid quote-char specification: quote character must be a single character")
+		return NG
+	}
+
+	escapeRune, err := getCharRune("escape character", escapeChar)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid escape-char specification:", err)
+		return NG
+	}
+
+	recordSeparator, err := parseLineEnding(lineEnding)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid line-ending specification:", err)
+		return NG
+	}
+
+	csvFormat := Format{
+		Delimiter:  delimiterRune,
+		Quoting:    quoting,
+		QuoteChar:  quoteRune,
+		EscapeChar: escapeRune,
+		LineEnding: recordSeparator,
+		WithBom:    withBom,
+	}
+	if err := validateCSVFormat(csvFormat); err != nil {
+		fmt.Fprintln(output, "Invalid CSV specification:", err)
+		return NG
+	}
+
+	parsedInputFormat, err := parseInputFormat(inputFormat)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid input format specification:", err)
+		return NG
+	}
+
+	parsedOutputFormat, err := parseOutputFormat(outputFormat)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid output format specification:", err)
+		return NG
+	}
+
+	parsedHeaderCase, err := parseHeaderCase(headerCase)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid header-case specification:", err)
+		return NG
+	}
+
+	sortKeys, err := parseSortKeys(sortSpecs)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid sort specification:", err)
+		return NG
+	}
+
+	if onInvalidFile != OnInvalidFileError && onInvalidFile != OnInvalidFileSkip {
+		fmt.Fprintln(output, "Invalid on-invalid-file specification: must be one of error, skip")
+		return NG
+	}
+
+	if _, err := parseStatsFormat(statsFormat); err != nil {
+		fmt.Fprintln(output, "Invalid stats specification:", err)
+		return NG
+	}
+
+	split := Split{Rows: splitRows, By: splitBy}
+	if splitRows < 0 {
+		fmt.Fprintln(output, "Invalid split specification: rows must not be negative")
+		return NG
+	}
+	if splitBytes != "" {
+		if split.Bytes, err = parseSize(splitBytes); err != nil {
+			fmt.Fprintln(output, "Invalid split specification:", err)
+			return NG
+		}
+	}
+
 	if help {
 		flagSet.Usage()
 		return OK
 	}
 
-	if xmlPath == "" || mappingPath == "" || csvPath == "" {
+	if tables {
+		if xmlPath == "" || csvPath == "" {
+			flagSet.Usage()
+			return NG
+		}
+
+		htmlPaths, err := findXML(xmlPath)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+
+		if err := convertTables(htmlPaths, csvPath, csvFormat); err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+
+		return OK
+	}
+
+	// マッピングファイルを指定しない場合は、コマンドラインでのマッピング指定が必要
+	if xmlPath == "" || csvPath == "" || (mappingPath == "" && (rowsPath == "" || len(columnSpecs) == 0)) {
 		flagSet.Usage()
 		return NG
 	}
 
-	mapping, err := loadMapping(mappingPath)
+	mapping, err := buildMapping(mappingPath, rowsPath, where, columnSpecs)
 	if err != nil {
 		fmt.Fprintln(output, err)
 		return NG
 	}
 
-	csvFile, err := os.Create(csvPath)
-	if err != nil {
-		fmt.Fprintln(output, err)
+	if err := validateSortKeys(sortKeys, mapping.outputHeaders()); err != nil {
+		fmt.Fprintln(output, "Invalid sort specification:", err)
 		return NG
 	}
-	defer csvFile.Close()
+
+	if split.By != "" && !slices.Contains(mapping.outputHeaders(), split.By) {
+		fmt.Fprintf(output, "Invalid split specification: split key '%s' is not a header of the output\n", split.By)
+		return NG
+	}
+	if split.enabled() {
+		if err := validateSplitTemplate(csvPath, split); err != nil {
+			fmt.Fprintln(output, "Invalid split specification:", err)
+			return NG
+		}
+	}
 
 	xmlPaths, err := findXML(xmlPath)
 	if err != nil {
@@ -121,52 +399,263 @@ func run(arguments []string, output io.Writer) int {
 		return NG
 	}
 
-	if err := convert(xmlPaths, mapping, csvFile, Format{Delimiter: delimiterRune, WithBom: withBom}); err != nil {
+	var state *processedState
+	var changedStates map[string]fileState
+	if statePath != "" {
+		// 変更の無いファイルは変換しないため、出力を上書きすると前回までの行が失われる
+		if !appendOutput {
+			fmt.Fprintln(output, "Invalid state specification: --state requires --append")
+			return NG
+		}
+
+		if state, err = loadState(statePath); err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+
+		// 前回から追加、変更されたファイルのみ変換
+		if xmlPaths, changedStates, err = state.changed(xmlPaths); err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+	}
+
+	if schemaPath != "" {
+		schema, err := loadXSD(schemaPath)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+
+		// スキーマに適合しない入力は変換前に除く
+		var invalidPaths []string
+		xmlPaths, invalidPaths, err = validateFiles(xmlPaths, newSchemaValidator(schema), parsedInputFormat, onInvalidFile == OnInvalidFileSkip, output)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+
+		// 読み飛ばしたファイルは、次回に再度変換するため状態に記録しない
+		for _, invalidPath := range invalidPaths {
+			if key, err := filepath.Abs(invalidPath); err == nil {
+				delete(changedStates, key)
+			}
+		}
+	}
+
+	format := csvFormat
+	format.InputFormat = parsedInputFormat
+	format.OutputFormat = resolveOutputFormat(csvPath, parsedOutputFormat)
+	format.NullValue = mapping.NullValue
+	format.SortKeys = sortKeys
+	format.Split = split
+	format.WithoutHeader = noHeader
+	format.HeaderCase = parsedHeaderCase
+	format.HeaderPrefix = headerPrefix
+	format.Rejects = output
+	if descriptionRow {
+		format.Descriptions = mapping.outputDescriptions()
+	}
+	if flagSet.Changed("null-value") {
+		format.NullValue = nullValue
+	}
+
+	if (noHeader || descriptionRow) && format.OutputFormat == OutputFormatJSON {
+		fmt.Fprintln(output, "Invalid header specification: --no-header and --description-row cannot be used with JSON output")
+		return NG
+	}
+
+	if format.OutputFormat == OutputFormatFixed {
+		if err := validateFixedWidth(mapping); err != nil {
+			fmt.Fprintln(output, "Invalid fixed-width specification:", err)
+			return NG
+		}
+		if descriptionRow {
+			fmt.Fprintln(output, "Invalid header specification: --description-row cannot be used with fixed-width output")
+			return NG
+		}
+
+		// 固定長ではヘッダを出力しない
+		format.WithoutHeader = true
+		format.FixedColumns = mapping.Columns
+	}
+
+	if appendOutput && (split.enabled() || format.OutputFormat == OutputFormatJSON) {
+		fmt.Fprintln(output, "Invalid append specification: cannot be used with split or JSON output")
+		return NG
+	}
+
+	if progress || statsFormat != "" {
+		var headers []string
+		for _, column := range mapping.Columns {
+			headers = append(headers, column.Header)
+		}
+		format.Monitor = newMonitor(xmlPaths, headers)
+
+		if progress {
+			format.Monitor.startProgress(progressOutput)
+		}
+	}
+
+	if split.enabled() {
+		// 出力ファイル名はテンプレートとして扱う
+		err = convertSplit(xmlPaths, mapping, csvPath, format)
+	} else {
+		err = convertFile(xmlPaths, mapping, csvPath, format, appendOutput)
+	}
+	if format.Monitor != nil {
+		format.Monitor.stopProgress()
+	}
+	if err != nil {
 		fmt.Fprintln(output, err)
 		return NG
 	}
 
+	if state != nil {
+		state.record(changedStates)
+		if err := state.save(statePath); err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+	}
+
+	if statsFormat != "" {
+		if err := format.Monitor.printStats(output, statsFormat); err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+	}
+
 	return OK
 }
 
-// convert converts XML files to CSV according to the mapping.
+// convert converts XML (or JSON) files to CSV according to the mapping.
 func convert(xmlPaths []string, mapping *Mapping, writer io.Writer, format Format) error {
 
-	if format.WithBom {
-		// BOMを付与
-		if _, err := writer.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+	rowWriter, err := newRowWriter(writer, mapping.outputHeaders(), format)
+	if err != nil {
+		return err
+	}
+
+	return convertRows(xmlPaths, mapping, rowWriter, format)
+}
+
+// convertFile converts the files to the CSV file. If appending, the rows are appended to the existing file.
+func convertFile(xmlPaths []string, mapping *Mapping, csvPath string, format Format, appendOutput bool) error {
+
+	var csvFile *os.File
+	var err error
+	if appendOutput {
+		var exists bool
+		if csvFile, exists, err = openAppend(csvPath, mapping.outputHeaders(), format); err != nil {
+			return err
+		}
+		if exists {
+			// 既存のファイルにはヘッダとBOMを出力しない
+			format.WithoutHeader = true
+			format.WithBom = false
+		}
+	} else {
+		if csvFile, err = os.Create(csvPath); err != nil {
 			return err
 		}
 	}
+	defer csvFile.Close()
 
-	csvWriter := customcsv.NewWriter(writer)
-	csvWriter.Delimiter = format.Delimiter
+	return convert(xmlPaths, mapping, csvFile, format)
+}
 
-	// header
-	var headers []string
-	for _, column := range mapping.Columns {
-		headers = append(headers, column.Header)
-	}
+// convertSplit converts the files to CSV files split by the number of rows, the size or the value.
+func convertSplit(xmlPaths []string, mapping *Mapping, csvPath string, format Format) error {
 
-	err := csvWriter.Write(headers)
+	splitWriter, err := newSplitRowWriter(csvPath, mapping.outputHeaders(), format, format.Split)
 	if err != nil {
 		return err
 	}
+	defer splitWriter.close()
+
+	return convertRows(xmlPaths, mapping, splitWriter, format)
+}
+
+// convertRows converts the files and writes the rows to the writer, removing duplicates, aggregating and sorting.
+func convertRows(xmlPaths []string, mapping *Mapping, rowWriter rowWriter, format Format) error {
+
+	rowWriter, closeWriter := newPipelineRowWriter(rowWriter, mapping, format)
+	defer closeWriter()
 
 	// rows
 	for _, xmlPath := range xmlPaths {
-		err = convertOne(xmlPath, mapping, csvWriter)
+		if format.Monitor != nil {
+			format.Monitor.beginFile(xmlPath)
+		}
+
+		err := convertOne(xmlPath, mapping, format, rowWriter)
 		if err != nil {
 			return err
 		}
+
+		if format.Monitor != nil {
+			format.Monitor.endFile()
+		}
+	}
+
+	return rowWriter.Flush()
+}
+
+// newPipelineRowWriter wraps the writer to check the constraints, remove duplicates, aggregate and sort the rows.
+// The returned function removes the temporary files used by the wrappers.
+func newPipelineRowWriter(rowWriter rowWriter, mapping *Mapping, format Format) (rowWriter, func()) {
+
+	var headers []string
+	for _, column := range mapping.Columns {
+		headers = append(headers, column.Header)
+	}
+	outputHeaders := mapping.outputHeaders()
+
+	var closers []func()
+	closeWriter := func() {
+		for _, closer := range closers {
+			closer()
+		}
 	}
 
-	csvWriter.Flush()
+	if format.Monitor != nil {
+		// 重複の除外や集計、並び替えの後に出力した行を記録
+		rowWriter = format.Monitor.wrapOutput(rowWriter)
+	}
 
-	return nil
+	// 制約の判定、重複の除外、集計、並び替えの順に行う
+	if len(format.SortKeys) != 0 {
+		sortWriter := newSortRowWriter(rowWriter, outputHeaders, format.SortKeys)
+		closers = append(closers, sortWriter.close)
+		rowWriter = sortWriter
+	}
+
+	if mapping.isAggregation() {
+		rowWriter = newAggregateRowWriter(rowWriter, headers, mapping.GroupBy, mapping.Aggregates)
+	}
+
+	if mapping.Distinct != nil {
+		distinctWriter := newDistinctRowWriter(rowWriter, headers, mapping.Distinct)
+		closers = append(closers, distinctWriter.close)
+		rowWriter = distinctWriter
+	}
+
+	if format.Monitor != nil {
+		// 制約を満たした、重複の除外や集計の前の行を記録
+		rowWriter = format.Monitor.wrapWriter(rowWriter)
+	}
+
+	if mapping.hasConstraints() {
+		constraintWriter := newConstraintRowWriter(rowWriter, mapping.Columns)
+		closers = append(closers, constraintWriter.close)
+		rowWriter = constraintWriter
+	}
+
+	return rowWriter, closeWriter
 }
 
-func convertOne(xmlPath string, mapping *Mapping, csvWriter *customcsv.Writer) error {
+func convertOne(xmlPath string, mapping *Mapping, format Format, rowWriter rowWriter) error {
 
 	reader, err := open(xmlPath)
 	if err != nil {
@@ -174,63 +663,262 @@ func convertOne(xmlPath string, mapping *Mapping, csvWriter *customcsv.Writer) e
 	}
 	defer reader.Close()
 
-	parser, err := xmlquery.CreateStreamParser(reader, mapping.RowsPath)
+	var input io.Reader = reader
+	if format.Monitor != nil {
+		input = format.Monitor.wrapReader(reader)
+	}
+
+	return convertReader(input, xmlPath, mapping, resolveInputFormat(xmlPath, format.InputFormat), rowWriter, format.Rejects)
+}
+
+// convertReader converts the rows read from the reader. The path is used for the error messages.
+// The invalid rows skipped by onInvalidRow are reported to rejects.
+func convertReader(reader io.Reader, xmlPath string, mapping *Mapping, inputFormat InputFormat, rowWriter rowWriter, rejects io.Writer) error {
+
+	rows, err := newRowReader(reader, xmlPath, inputFormat, mapping.RowsPath)
 	if err != nil {
-		return fmt.Errorf("xpath '%s' is failed: %w", mapping.RowsPath, err)
+		return err
 	}
 
+	// 全ての行で同じ式を使うため、入力ごとに一度だけコンパイル
+	exprs, err := compileColumnPaths(mapping.Columns)
+	if err != nil {
+		return err
+	}
+
+	rowNumber := 0
 	for {
-		row, err := parser.Read()
+		row, err := rows.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return fmt.Errorf("%s is failed: %w", xmlPath, err)
 		}
+		rowNumber++
 
-		var values []string
-		for _, column := range mapping.Columns {
-			value, err := getValue(row, column.ValuePath, column.UseEvaluate)
+		skip := func(err error) {
+			if rejects != nil {
+				fmt.Fprintf(rejects, "skipped: %s: row %d: %v\n", xmlPath, rowNumber, err)
+			}
+		}
+
+		if mapping.Filter != "" {
+			matched, err := matchFilter(row, mapping.Filter)
 			if err != nil {
 				return err
 			}
+			if !matched {
+				continue
+			}
+		}
 
-			values = append(values, value)
+		values, err := getColumnValues(row, mapping.Columns, exprs)
+		if err != nil {
+			var invalidRowErr *invalidRowError
+			if !errors.As(err, &invalidRowErr) {
+				return err
+			}
+
+			if mapping.OnInvalidRow == OnInvalidRowSkip {
+				skip(err)
+				continue
+			}
+			return fmt.Errorf("%s is failed: row %d: %w", xmlPath, rowNumber, err)
 		}
 
-		err = csvWriter.Write(values)
+		err = rowWriter.Write(values)
 		if err != nil {
-			return err
+			// 制約に違反した行
+			var invalidRowErr *invalidRowError
+			if errors.As(err, &invalidRowErr) && mapping.OnInvalidRow == OnInvalidRowSkip {
+				skip(err)
+				continue
+			}
+			return fmt.Errorf("%s is failed: row %d: %w", xmlPath, rowNumber, err)
 		}
 	}
 
 	return nil
 }
 
-func getValue(row *xmlquery.Node, valuePath string, useEvaluate bool) (string, error) {
+// getColumnValues gets the values of the columns from the row, applying the defaults and the transforms.
+// A missing value is nil. If a required value is missing or empty, an invalidRowError is returned.
+// The exprs are the compiled valuePaths of the columns by compileColumnPaths.
+func getColumnValues(row xpath.NodeNavigator, columns []Column, exprs []*xpath.Expr) ([]*string, error) {
+
+	var values []*string
+	for i, column := range columns {
+		var value *string
+		if column.UseEvaluate {
+			var err error
+			if value, err = getValue(row, column.ValuePath, true); err != nil {
+				return nil, err
+			}
+		} else {
+			value = selectValue(row, exprs[i])
+		}
+
+		if value != nil {
+			transformed := applyTransforms(*value, column.Transforms)
+			value = &transformed
+		} else if column.Default != nil {
+			value = column.Default
+		}
+
+		if column.Required && (value == nil || *value == "") {
+			return nil, &invalidRowError{message: fmt.Sprintf("column '%s' is required", column.Header)}
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// matchFilter evaluates the filter expression against the row, and converts the result to boolean as XPath boolean().
+func matchFilter(row xpath.NodeNavigator, filter string) (bool, error) {
+
+	// Evaluateは式の内部状態を使うため、キャッシュせずにコンパイル
+	expr, err := xpath.Compile(filter)
+	if err != nil {
+		return false, fmt.Errorf("xpath '%s' is failed: %w", filter, err)
+	}
+
+	switch result := expr.Evaluate(row.Copy()).(type) {
+	case bool:
+		return result, nil
+	case float64:
+		return result != 0 && !math.IsNaN(result), nil
+	case string:
+		return result != "", nil
+	case *xpath.NodeIterator:
+		return result.MoveNext(), nil
+	default:
+		return false, fmt.Errorf("xpath '%s' is failed: unsupported result %v", filter, result)
+	}
+}
+
+// getValue gets the value by the XPath. If no node matches, nil is returned.
+func getValue(row xpath.NodeNavigator, valuePath string, useEvaluate bool) (*string, error) {
 
 	// Node以外を返すような式の場合(count()、boolean()など)
 	if useEvaluate {
+		// Evaluateは式の内部状態を使うため、キャッシュせずにコンパイル
 		expr, err := xpath.Compile(valuePath)
 		if err != nil {
-			return "", fmt.Errorf("xpath '%s' is failed: %w", valuePath, err)
+			return nil, fmt.Errorf("xpath '%s' is failed: %w", valuePath, err)
 		}
 
-		value := expr.Evaluate(xmlquery.CreateXPathNavigator(row))
-		return fmt.Sprint(value), nil
+		value := fmt.Sprint(expr.Evaluate(row.Copy()))
+		return &value, nil
 	}
 
 	// Nodeを返す場合
-	value, err := xmlquery.Query(row, valuePath)
+	expr, err := xpath.Compile(valuePath)
 	if err != nil {
-		return "", fmt.Errorf("xpath '%s' is failed: %w", valuePath, err)
+		return nil, fmt.Errorf("xpath '%s' is failed: %w", valuePath, err)
 	}
 
-	if value == nil {
-		return "", nil
+	return selectValue(row, expr), nil
+}
+
+// selectValue returns the text of the first node selected by the expression. If no node matches, nil is returned.
+func selectValue(row xpath.NodeNavigator, expr *xpath.Expr) *string {
+
+	iterator := expr.Select(row.Copy())
+	if !iterator.MoveNext() {
+		return nil
 	}
 
-	return value.InnerText(), nil
+	value := innerText(iterator.Current())
+	return &value
+}
+
+// compileColumnPaths compiles the valuePaths of the columns for Select.
+// The expressions are kept only during the conversion, so that the expressions of the mappings are not accumulated.
+// For the columns with useEvaluate, nil is returned since Evaluate uses the internal state of the expression.
+func compileColumnPaths(columns []Column) ([]*xpath.Expr, error) {
+
+	exprs := make([]*xpath.Expr, len(columns))
+	for i, column := range columns {
+		if column.UseEvaluate {
+			continue
+		}
+
+		expr, err := xpath.Compile(column.ValuePath)
+		if err != nil {
+			return nil, fmt.Errorf("xpath '%s' is failed: %w", column.ValuePath, err)
+		}
+		exprs[i] = expr
+	}
+
+	return exprs, nil
+}
+
+// buildMapping builds the mapping from the mapping file and the command line.
+// Columns given on the command line override the columns with the same header, otherwise they are appended.
+func buildMapping(mappingPath string, rowsPath string, where string, columnSpecs []string) (*Mapping, error) {
+
+	mapping := &Mapping{}
+	if mappingPath != "" {
+		loaded, err := loadMapping(mappingPath)
+		if err != nil {
+			return nil, err
+		}
+		mapping = loaded
+	}
+
+	if rowsPath != "" {
+		mapping.RowsPath = rowsPath
+	}
+
+	if where != "" {
+		if _, err := xpath.Compile(where); err != nil {
+			return nil, fmt.Errorf("where '%s' is invalid: %w", where, err)
+		}
+		mapping.Filter = where
+	}
+
+	for _, columnSpec := range columnSpecs {
+		column, err := parseColumnSpec(columnSpec)
+		if err != nil {
+			return nil, err
+		}
+
+		mapping.Columns = mergeColumn(mapping.Columns, column)
+	}
+
+	return mapping, nil
+}
+
+// parseColumnSpec parses a column specification in the form of 'header=valuePath' or 'header=valuePath!eval'.
+func parseColumnSpec(columnSpec string) (Column, error) {
+
+	header, valuePath, found := strings.Cut(columnSpec, "=")
+	if !found || header == "" || valuePath == "" {
+		return Column{}, fmt.Errorf("invalid column specification '%s': must be 'header=valuePath'", columnSpec)
+	}
+
+	column := Column{Header: header, ValuePath: valuePath}
+	if strings.HasSuffix(valuePath, evalSuffix) {
+		column.ValuePath = strings.TrimSuffix(valuePath, evalSuffix)
+		column.UseEvaluate = true
+	}
+
+	return column, nil
+}
+
+func mergeColumn(columns []Column, column Column) []Column {
+
+	for i := range columns {
+		if columns[i].Header == column.Header {
+			columns[i] = column
+			return columns
+		}
+	}
+
+	return append(columns, column)
 }
 
 func loadMapping(path string) (*Mapping, error) {
@@ -246,14 +934,115 @@ func loadMapping(path string) (*Mapping, error) {
 		return nil, err
 	}
 
+	return parseMapping(path, content)
+}
+
+// parseMapping parses the mapping in the format determined by the path and the content.
+func parseMapping(path string, content []byte) (*Mapping, error) {
+
 	var mapping Mapping
-	if err := json.Unmarshal(content, &mapping); err != nil {
+	var err error
+	switch detectMappingFormat(path, content) {
+	case MappingFormatYAML:
+		err = yaml.Unmarshal(content, &mapping)
+	case MappingFormatTOML:
+		err = toml.Unmarshal(content, &mapping)
+	default:
+		err = json.Unmarshal(content, &mapping)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("invalid mapping format: %w", err)
 	}
 
+	if err := validateMapping(&mapping); err != nil {
+		return nil, fmt.Errorf("invalid mapping: %w", err)
+	}
+
 	return &mapping, nil
 }
 
+// validateMapping checks the definitions which cannot be checked by unmarshaling.
+func validateMapping(mapping *Mapping) error {
+
+	if mapping.Filter != "" {
+		if _, err := xpath.Compile(mapping.Filter); err != nil {
+			return fmt.Errorf("filter '%s' is invalid: %w", mapping.Filter, err)
+		}
+	}
+
+	switch mapping.OnInvalidRow {
+	case "", OnInvalidRowError, OnInvalidRowSkip:
+	default:
+		return fmt.Errorf("onInvalidRow must be one of error, skip")
+	}
+
+	if mapping.Distinct != nil {
+		if err := validateDistinct(mapping.Distinct, mapping.Columns); err != nil {
+			return err
+		}
+	}
+
+	if err := validateAggregation(mapping.GroupBy, mapping.Aggregates, mapping.Columns); err != nil {
+		return err
+	}
+
+	for _, column := range mapping.Columns {
+		if column.Type != "" && !slices.Contains(columnTypes, column.Type) {
+			return fmt.Errorf("column '%s' type must be one of %s", column.Header, strings.Join(columnTypes, ", "))
+		}
+
+		if err := validateTransforms(column.Transforms); err != nil {
+			return fmt.Errorf("column '%s' %w", column.Header, err)
+		}
+
+		if column.Constraints != nil {
+			if err := validateConstraints(column.Constraints); err != nil {
+				return fmt.Errorf("column '%s' %w", column.Header, err)
+			}
+		}
+
+		if err := validateFixedWidthColumn(column); err != nil {
+			return fmt.Errorf("column '%s' %w", column.Header, err)
+		}
+	}
+
+	return nil
+}
+
+// detectMappingFormat determines the mapping format from the extension, or from the content if the extension is unknown.
+func detectMappingFormat(path string, content []byte) MappingFormat {
+
+	switch extension(path) {
+	case ".json":
+		return MappingFormatJSON
+	case ".yaml", ".yml":
+		return MappingFormatYAML
+	case ".toml":
+		return MappingFormatTOML
+	}
+
+	// 拡張子で判断できない場合は内容から判断
+	trimmed := bytes.TrimSpace(content)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return MappingFormatJSON
+	}
+
+	for _, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// TOMLは "key = value" もしくは "[[columns]]" の形式で始まる
+		if strings.HasPrefix(line, "[") || tomlKeyValuePattern.MatchString(line) {
+			return MappingFormatTOML
+		}
+		break
+	}
+
+	return MappingFormatYAML
+}
+
 func findXML(path string) ([]string, error) {
 
 	if isURL(path) {
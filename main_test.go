@@ -1,14 +1,13 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
-	"github.com/onozaty/go-customcsv"
+	"github.com/antchfx/xmlquery"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -409,6 +408,1110 @@ func TestRun_Delimiter_Invalid_MultiChar(t *testing.T) {
 	assert.Contains(t, out.String(), "delimiter must be a single character")
 }
 
+func TestRun_JSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/json/items.json"
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//items/*",
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id"
+			},
+			{
+				"header": "name",
+				"valuePath": "/name"
+			},
+			{
+				"header": "tags",
+				"valuePath": "count(/tags/*)",
+				"useEvaluate": true
+			},
+			{
+				"header": "active",
+				"valuePath": "/active"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id,name,tags,active",
+		"1,name1,2,true",
+		"2,name2,0,false",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_InputFormat_JSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 拡張子では判断できないファイル
+	inputPath := createFile(t, temp, "input.txt", `[{"name": "a"}, {"name": "b"}]`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"--input-format", "json",
+			"-r", "/*",
+			"-c", "name=/name",
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"name",
+		"a",
+		"b",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_InputFormat_Invalid(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", "output.csv",
+			"--input-format", "csv",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := "Invalid input format specification: input format must be one of xml, json, html\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_InvalidJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.json", `{"items": [`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//items/*",
+			"-c", "name=/name",
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Contains(t, out.String(), inputPath+" is failed: ")
+}
+
+func TestRun_HTML(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/html/tables.html"
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//table[@id='country']/tbody/tr",
+		"columns": [
+			{
+				"header": "code",
+				"valuePath": "/td[1]"
+			},
+			{
+				"header": "name",
+				"valuePath": "normalize-space(/td[2])",
+				"useEvaluate": true
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"code,name",
+		"JP,Japan",
+		"US,United States",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Tables(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/html/tables.html"
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-o", outputPath,
+			"--tables",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	assert.Equal(t,
+		joinRows(
+			"Code,Name,Capital",
+			"JP,Japan,Tokyo",
+			"US,United States,\"Washington, D.C.\"",
+		),
+		readString(t, filepath.Join(temp, "output-1.csv")))
+
+	assert.Equal(t,
+		joinRows(
+			"Code,Name",
+			"ja,Japanese",
+			"en,English",
+		),
+		readString(t, filepath.Join(temp, "output-2.csv")))
+
+	assert.NoFileExists(t, filepath.Join(temp, "output-3.csv"))
+	assert.NoFileExists(t, outputPath)
+}
+
+func TestRun_Tables_NotFound(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.html", `<html><body><p>no table</p></body></html>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-o", outputPath,
+			"--tables",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "table is not found\n", out.String())
+}
+
+func TestRun_Transforms(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item>
+		<name>
+			name1
+		</name>
+		<flag>Y</flag>
+	</item>
+	<item>
+		<name>  name  2 </name>
+		<flag>N</flag>
+	</item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "name",
+				"valuePath": "/name",
+				"transforms": [
+					{"trim": true},
+					{"regexReplace": ["\\s+", "_"]},
+					{"uppercase": true}
+				]
+			},
+			{
+				"header": "flag",
+				"valuePath": "/flag",
+				"transforms": [
+					{"map": {"Y": "yes", "N": "no"}}
+				]
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"name,flag",
+		"NAME1,yes",
+		"NAME_2,no",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_InvalidTransforms(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/rss.xml"
+
+	mappingPath := createFile(t, temp, "mapping.yaml", `
+rowsPath: //item
+columns:
+  - header: title
+    valuePath: /title
+    transforms:
+      - regexReplace: ["(", ""]
+`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := "invalid mapping: column 'title' transforms[0]: regexReplace pattern is invalid: error parsing regexp: missing closing ): `(`\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_Default(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>name1</name></item>
+	<item><id>2</id><name></name></item>
+	<item><id>3</id></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id"
+			},
+			{
+				"header": "name",
+				"valuePath": "/name",
+				"default": "NULL"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id,name",
+		"1,name1",
+		"2,",
+		"3,NULL",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Required(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>name1</name></item>
+	<item><id> </id><name>name2</name></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id",
+				"transforms": [{"trim": true}],
+				"required": true
+			},
+			{
+				"header": "name",
+				"valuePath": "/name"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := inputPath + " is failed: row 2: column 'id' is required\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_Required_Skip(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>name1</name></item>
+	<item><name>name2</name></item>
+	<item><id>3</id><name>name3</name></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"onInvalidRow": "skip",
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id",
+				"required": true
+			},
+			{
+				"header": "name",
+				"valuePath": "/name"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	assert.Equal(t, "skipped: "+inputPath+": row 2: column 'id' is required\n", out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id,name",
+		"1,name1",
+		"3,name3",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_NullValue(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>name1</name></item>
+	<item><id>2</id><name></name></item>
+	<item><id>3</id></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "name=/name",
+			"-o", outputPath,
+			"--null-value", `\N`,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id,name",
+		"1,name1",
+		"2,",
+		`3,\N`,
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_NullValue_Mapping(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"nullValue": "NULL",
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id"
+			},
+			{
+				"header": "name",
+				"valuePath": "/name"
+			},
+			{
+				"header": "value",
+				"valuePath": "/value",
+				"default": "0"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	overriddenPath := filepath.Join(temp, "overridden.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+	overriddenExitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", overriddenPath,
+			"--null-value", "",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Equal(t, OK, overriddenExitCode)
+	require.Empty(t, out.String())
+
+	// defaultがnullValueより優先される
+	assert.Equal(t, joinRows("id,name,value", "1,NULL,0"), readString(t, outputPath))
+	assert.Equal(t, joinRows("id,name,value", "1,,0"), readString(t, overriddenPath))
+}
+
+func TestRun_OutputJSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><name>"name1" &lt;a&gt;</name></item>
+	<item><id>2</id><name></name></item>
+	<item><id>3</id></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.json")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "name=/name",
+			"-o", outputPath,
+			"--null-value", `\N`,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// JSONでは存在しないノードはnullとなる
+	result := readString(t, outputPath)
+	expect := `[
+  {"id": "1", "name": "\"name1\" <a>"},
+  {"id": "2", "name": ""},
+  {"id": "3", "name": null}
+]
+`
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_OutputJSON_Empty(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root></root>`)
+
+	outputPath := filepath.Join(temp, "output.txt")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"--output-format", "json",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	assert.Equal(t, "[]\n", readString(t, outputPath))
+}
+
+func TestRun_OutputFormat_Invalid(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", "output.csv",
+			"--output-format", "xml",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := "Invalid output format specification: output format must be one of csv, json, fixed\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_Filter(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item status="active"><id>1</id><amount>10</amount></item>
+	<item status="inactive"><id>2</id><amount>5</amount></item>
+	<item status="active"><id>3</id><amount>0</amount></item>
+	<item status="active"><id>4</id></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"filter": "/@status='active' and /amount > 0",
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id",
+		"1",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Where(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item status="active"><id>1</id><amount>10</amount></item>
+	<item status="inactive"><id>2</id><amount>5</amount></item>
+	<item status="active"><id>3</id><amount>0</amount></item>
+	<item status="active"><id>4</id></item>
+	</root>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"filter": "/@status='active'",
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+			"--where", "/amount",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// mappingのfilterは--whereで置き換えられる
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id",
+		"1",
+		"2",
+		"3",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Where_Invalid(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", outputPath,
+			"--where", "/title[",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := "where '/title[' is invalid: expression must evaluate to a node-set\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_InvalidFilter(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/rss.xml"
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"filter": "/title[",
+		"columns": [
+			{
+				"header": "title",
+				"valuePath": "/title"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := "invalid mapping: filter '/title[' is invalid: expression must evaluate to a node-set\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_InvalidOnInvalidRow(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/rss.xml"
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"onInvalidRow": "ignore",
+		"columns": [
+			{
+				"header": "title",
+				"valuePath": "/title"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := "invalid mapping: onInvalidRow must be one of error, skip\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_InvalidColumnType(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mappingPath := createFile(t, temp, "mapping.yaml", `
+rowsPath: //item
+columns:
+  - header: title
+    valuePath: /title
+    type: integr
+`)
+
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", mappingPath,
+			"-o", filepath.Join(temp, "output.csv"),
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := "invalid mapping: column 'title' type must be one of string, integer, number, boolean, date, datetime, time\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_InlineMapping(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/junit"
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"--rows", "//testcase",
+			"--column", "name=/@name",
+			"--column", "success=not(/*)!eval",
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"name,success",
+		"test1,true",
+		"test2,false",
+		"test3,false",
+		"test4,false",
+		"test5,true",
+		"test1,true",
+		"test2,true",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_InlineMapping_WithMappingFile(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/rss.xml"
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "title",
+				"valuePath": "/title"
+			},
+			{
+				"header": "link",
+				"valuePath": "/link"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-c", "title=string-length(/title)!eval", // 上書き
+			"-c", "description=/description", // 追加
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"title,link,description",
+		"12,https://www.w3schools.com/xml/xml_rss.asp,New RSS tutorial on W3Schools",
+		"12,https://www.w3schools.com/xml,New XML tutorial on W3Schools",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_InlineMapping_InvalidColumn(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := "testdata/rss.xml"
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "/title",
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := "invalid column specification '/title': must be 'header=valuePath'\n"
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_InlineMapping_NoneRows(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "xxx",
+			"-c", "title=/title",
+			"-o", "yyy",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Contains(t, out.String(), "Usage: xml2csv [flags]")
+}
+
 func TestRun_CommandParseFailed(t *testing.T) {
 
 	// ARRANGE
@@ -430,12 +1533,37 @@ func TestRun_CommandParseFailed(t *testing.T) {
 Usage: xml2csv [flags]
 
 Flags
-  -i, --input string       XML input file path or directory or url
-  -m, --mapping string     XML to CSV mapping file path or url
-  -o, --output string      CSV output file path
-  -d, --delimiter string   (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
-  -b, --bom                (optional) CSV with BOM
-  -h, --help               Help
+  -i, --input string             XML input file path or directory or url
+      --input-format string      (optional) Input format (xml, json, html) (default determined by extension)
+  -m, --mapping string           XML to CSV mapping file path or url
+  -r, --rows string              (optional) XPath to get as a rows (overrides rowsPath in mapping)
+      --where string             (optional) XPath expression to filter rows (overrides filter in mapping)
+  -c, --column stringArray       (optional) Column as 'header=valuePath' ('!eval' suffix for useEvaluate), repeatable
+      --sort-by stringArray      (optional) Sort rows by 'header[:desc][:numeric]', repeatable
+  -o, --output string            CSV output file path
+      --append                   (optional) Append to the output file without the header if it exists
+      --state string             (optional) State file path to convert only new or changed files (requires --append)
+      --schema string            (optional) XSD file path or url to validate the inputs before conversion
+      --on-invalid-file string   (optional) Handling of the inputs invalid against the schema (error, skip) (default "error")
+      --split-rows int           (optional) Split output into files of at most N rows
+      --split-bytes string       (optional) Split output into files of at most SIZE (e.g. '100MB')
+      --split-by string          (optional) Split output into a file per value of the header
+      --output-format string     (optional) Output format (csv, json, fixed) (default determined by extension)
+  -d, --delimiter string         (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
+  -b, --bom                      (optional) CSV with BOM
+      --quote string             (optional) CSV quoting (always, minimal, never, nonnumeric) (default "minimal")
+      --quote-char string        (optional) CSV quote character (default "\"")
+      --escape-char string       (optional) CSV escape character instead of doubling the quote (e.g. '\\' for MySQL LOAD DATA)
+      --line-ending string       (optional) CSV line ending (crlf, lf) (default "crlf")
+      --null-value string        (optional) CSV output value for missing nodes (overrides nullValue in mapping) (e.g. '\N')
+      --no-header                (optional) Output without the header
+      --header-case string       (optional) Convert the case of the header (snake, upper, lower)
+      --header-prefix string     (optional) Prefix added to the header
+      --description-row          (optional) Output the descriptions of the columns as the second header row
+      --tables                   (optional) Convert every <table> in HTML to CSV without mapping
+      --progress                 (optional) Show progress on stderr
+      --stats string[="text"]    (optional) Print summary of the conversion ('--stats' or '--stats=json')
+  -h, --help                     Help
 
 unknown shorthand flag: 'a' in -a
 `
@@ -463,12 +1591,37 @@ func TestRun_Help(t *testing.T) {
 Usage: xml2csv [flags]
 
 Flags
-  -i, --input string       XML input file path or directory or url
-  -m, --mapping string     XML to CSV mapping file path or url
-  -o, --output string      CSV output file path
-  -d, --delimiter string   (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
-  -b, --bom                (optional) CSV with BOM
-  -h, --help               Help
+  -i, --input string             XML input file path or directory or url
+      --input-format string      (optional) Input format (xml, json, html) (default determined by extension)
+  -m, --mapping string           XML to CSV mapping file path or url
+  -r, --rows string              (optional) XPath to get as a rows (overrides rowsPath in mapping)
+      --where string             (optional) XPath expression to filter rows (overrides filter in mapping)
+  -c, --column stringArray       (optional) Column as 'header=valuePath' ('!eval' suffix for useEvaluate), repeatable
+      --sort-by stringArray      (optional) Sort rows by 'header[:desc][:numeric]', repeatable
+  -o, --output string            CSV output file path
+      --append                   (optional) Append to the output file without the header if it exists
+      --state string             (optional) State file path to convert only new or changed files (requires --append)
+      --schema string            (optional) XSD file path or url to validate the inputs before conversion
+      --on-invalid-file string   (optional) Handling of the inputs invalid against the schema (error, skip) (default "error")
+      --split-rows int           (optional) Split output into files of at most N rows
+      --split-bytes string       (optional) Split output into files of at most SIZE (e.g. '100MB')
+      --split-by string          (optional) Split output into a file per value of the header
+      --output-format string     (optional) Output format (csv, json, fixed) (default determined by extension)
+  -d, --delimiter string         (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
+  -b, --bom                      (optional) CSV with BOM
+      --quote string             (optional) CSV quoting (always, minimal, never, nonnumeric) (default "minimal")
+      --quote-char string        (optional) CSV quote character (default "\"")
+      --escape-char string       (optional) CSV escape character instead of doubling the quote (e.g. '\\' for MySQL LOAD DATA)
+      --line-ending string       (optional) CSV line ending (crlf, lf) (default "crlf")
+      --null-value string        (optional) CSV output value for missing nodes (overrides nullValue in mapping) (e.g. '\N')
+      --no-header                (optional) Output without the header
+      --header-case string       (optional) Convert the case of the header (snake, upper, lower)
+      --header-prefix string     (optional) Prefix added to the header
+      --description-row          (optional) Output the descriptions of the columns as the second header row
+      --tables                   (optional) Convert every <table> in HTML to CSV without mapping
+      --progress                 (optional) Show progress on stderr
+      --stats string[="text"]    (optional) Print summary of the conversion ('--stats' or '--stats=json')
+  -h, --help                     Help
 
 `
 	assert.Equal(t, expect, out.String())
@@ -496,12 +1649,37 @@ func TestRun_NoneInput(t *testing.T) {
 Usage: xml2csv [flags]
 
 Flags
-  -i, --input string       XML input file path or directory or url
-  -m, --mapping string     XML to CSV mapping file path or url
-  -o, --output string      CSV output file path
-  -d, --delimiter string   (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
-  -b, --bom                (optional) CSV with BOM
-  -h, --help               Help
+  -i, --input string             XML input file path or directory or url
+      --input-format string      (optional) Input format (xml, json, html) (default determined by extension)
+  -m, --mapping string           XML to CSV mapping file path or url
+  -r, --rows string              (optional) XPath to get as a rows (overrides rowsPath in mapping)
+      --where string             (optional) XPath expression to filter rows (overrides filter in mapping)
+  -c, --column stringArray       (optional) Column as 'header=valuePath' ('!eval' suffix for useEvaluate), repeatable
+      --sort-by stringArray      (optional) Sort rows by 'header[:desc][:numeric]', repeatable
+  -o, --output string            CSV output file path
+      --append                   (optional) Append to the output file without the header if it exists
+      --state string             (optional) State file path to convert only new or changed files (requires --append)
+      --schema string            (optional) XSD file path or url to validate the inputs before conversion
+      --on-invalid-file string   (optional) Handling of the inputs invalid against the schema (error, skip) (default "error")
+      --split-rows int           (optional) Split output into files of at most N rows
+      --split-bytes string       (optional) Split output into files of at most SIZE (e.g. '100MB')
+      --split-by string          (optional) Split output into a file per value of the header
+      --output-format string     (optional) Output format (csv, json, fixed) (default determined by extension)
+  -d, --delimiter string         (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
+  -b, --bom                      (optional) CSV with BOM
+      --quote string             (optional) CSV quoting (always, minimal, never, nonnumeric) (default "minimal")
+      --quote-char string        (optional) CSV quote character (default "\"")
+      --escape-char string       (optional) CSV escape character instead of doubling the quote (e.g. '\\' for MySQL LOAD DATA)
+      --line-ending string       (optional) CSV line ending (crlf, lf) (default "crlf")
+      --null-value string        (optional) CSV output value for missing nodes (overrides nullValue in mapping) (e.g. '\N')
+      --no-header                (optional) Output without the header
+      --header-case string       (optional) Convert the case of the header (snake, upper, lower)
+      --header-prefix string     (optional) Prefix added to the header
+      --description-row          (optional) Output the descriptions of the columns as the second header row
+      --tables                   (optional) Convert every <table> in HTML to CSV without mapping
+      --progress                 (optional) Show progress on stderr
+      --stats string[="text"]    (optional) Print summary of the conversion ('--stats' or '--stats=json')
+  -h, --help                     Help
 
 `
 	assert.Equal(t, expect, out.String())
@@ -529,12 +1707,37 @@ func TestRun_NoneMapping(t *testing.T) {
 Usage: xml2csv [flags]
 
 Flags
-  -i, --input string       XML input file path or directory or url
-  -m, --mapping string     XML to CSV mapping file path or url
-  -o, --output string      CSV output file path
-  -d, --delimiter string   (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
-  -b, --bom                (optional) CSV with BOM
-  -h, --help               Help
+  -i, --input string             XML input file path or directory or url
+      --input-format string      (optional) Input format (xml, json, html) (default determined by extension)
+  -m, --mapping string           XML to CSV mapping file path or url
+  -r, --rows string              (optional) XPath to get as a rows (overrides rowsPath in mapping)
+      --where string             (optional) XPath expression to filter rows (overrides filter in mapping)
+  -c, --column stringArray       (optional) Column as 'header=valuePath' ('!eval' suffix for useEvaluate), repeatable
+      --sort-by stringArray      (optional) Sort rows by 'header[:desc][:numeric]', repeatable
+  -o, --output string            CSV output file path
+      --append                   (optional) Append to the output file without the header if it exists
+      --state string             (optional) State file path to convert only new or changed files (requires --append)
+      --schema string            (optional) XSD file path or url to validate the inputs before conversion
+      --on-invalid-file string   (optional) Handling of the inputs invalid against the schema (error, skip) (default "error")
+      --split-rows int           (optional) Split output into files of at most N rows
+      --split-bytes string       (optional) Split output into files of at most SIZE (e.g. '100MB')
+      --split-by string          (optional) Split output into a file per value of the header
+      --output-format string     (optional) Output format (csv, json, fixed) (default determined by extension)
+  -d, --delimiter string         (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
+  -b, --bom                      (optional) CSV with BOM
+      --quote string             (optional) CSV quoting (always, minimal, never, nonnumeric) (default "minimal")
+      --quote-char string        (optional) CSV quote character (default "\"")
+      --escape-char string       (optional) CSV escape character instead of doubling the quote (e.g. '\\' for MySQL LOAD DATA)
+      --line-ending string       (optional) CSV line ending (crlf, lf) (default "crlf")
+      --null-value string        (optional) CSV output value for missing nodes (overrides nullValue in mapping) (e.g. '\N')
+      --no-header                (optional) Output without the header
+      --header-case string       (optional) Convert the case of the header (snake, upper, lower)
+      --header-prefix string     (optional) Prefix added to the header
+      --description-row          (optional) Output the descriptions of the columns as the second header row
+      --tables                   (optional) Convert every <table> in HTML to CSV without mapping
+      --progress                 (optional) Show progress on stderr
+      --stats string[="text"]    (optional) Print summary of the conversion ('--stats' or '--stats=json')
+  -h, --help                     Help
 
 `
 	assert.Equal(t, expect, out.String())
@@ -562,12 +1765,37 @@ func TestRun_NoneOutput(t *testing.T) {
 Usage: xml2csv [flags]
 
 Flags
-  -i, --input string       XML input file path or directory or url
-  -m, --mapping string     XML to CSV mapping file path or url
-  -o, --output string      CSV output file path
-  -d, --delimiter string   (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
-  -b, --bom                (optional) CSV with BOM
-  -h, --help               Help
+  -i, --input string             XML input file path or directory or url
+      --input-format string      (optional) Input format (xml, json, html) (default determined by extension)
+  -m, --mapping string           XML to CSV mapping file path or url
+  -r, --rows string              (optional) XPath to get as a rows (overrides rowsPath in mapping)
+      --where string             (optional) XPath expression to filter rows (overrides filter in mapping)
+  -c, --column stringArray       (optional) Column as 'header=valuePath' ('!eval' suffix for useEvaluate), repeatable
+      --sort-by stringArray      (optional) Sort rows by 'header[:desc][:numeric]', repeatable
+  -o, --output string            CSV output file path
+      --append                   (optional) Append to the output file without the header if it exists
+      --state string             (optional) State file path to convert only new or changed files (requires --append)
+      --schema string            (optional) XSD file path or url to validate the inputs before conversion
+      --on-invalid-file string   (optional) Handling of the inputs invalid against the schema (error, skip) (default "error")
+      --split-rows int           (optional) Split output into files of at most N rows
+      --split-bytes string       (optional) Split output into files of at most SIZE (e.g. '100MB')
+      --split-by string          (optional) Split output into a file per value of the header
+      --output-format string     (optional) Output format (csv, json, fixed) (default determined by extension)
+  -d, --delimiter string         (optional) CSV output delimiter (e.g. ';' or '\t' for tab) (default ",")
+  -b, --bom                      (optional) CSV with BOM
+      --quote string             (optional) CSV quoting (always, minimal, never, nonnumeric) (default "minimal")
+      --quote-char string        (optional) CSV quote character (default "\"")
+      --escape-char string       (optional) CSV escape character instead of doubling the quote (e.g. '\\' for MySQL LOAD DATA)
+      --line-ending string       (optional) CSV line ending (crlf, lf) (default "crlf")
+      --null-value string        (optional) CSV output value for missing nodes (overrides nullValue in mapping) (e.g. '\N')
+      --no-header                (optional) Output without the header
+      --header-case string       (optional) Convert the case of the header (snake, upper, lower)
+      --header-prefix string     (optional) Prefix added to the header
+      --description-row          (optional) Output the descriptions of the columns as the second header row
+      --tables                   (optional) Convert every <table> in HTML to CSV without mapping
+      --progress                 (optional) Show progress on stderr
+      --stats string[="text"]    (optional) Print summary of the conversion ('--stats' or '--stats=json')
+  -h, --help                     Help
 
 `
 	assert.Equal(t, expect, out.String())
@@ -917,8 +2145,8 @@ func TestConvertOne(t *testing.T) {
 	</root>`)
 
 	var b bytes.Buffer
-	writer := bufio.NewWriter(&b)
-	csv := customcsv.NewWriter(writer)
+	csv, err := newCSVWriter(&b, Format{})
+	require.NoError(t, err)
 
 	mapping := Mapping{
 		RowsPath: "//item",
@@ -931,7 +2159,7 @@ func TestConvertOne(t *testing.T) {
 	}
 
 	// ACT
-	err := convertOne(inputPath, &mapping, csv)
+	err = convertOne(inputPath, &mapping, Format{}, &csvRowWriter{writer: csv})
 	csv.Flush()
 
 	// ASSERT
@@ -948,6 +2176,134 @@ func TestConvertOne(t *testing.T) {
 	assert.Equal(t, expect, result)
 }
 
+func TestParseColumnSpec(t *testing.T) {
+
+	// ARRANGE/ACT
+	result, err := parseColumnSpec("count=count(/tag)!eval")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := Column{Header: "count", ValuePath: "count(/tag)", UseEvaluate: true}
+	assert.Equal(t, expect, result)
+}
+
+func TestParseColumnSpec_ValuePathWithEqual(t *testing.T) {
+
+	// ARRANGE/ACT
+	result, err := parseColumnSpec("active=/item[@status='active']/name")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := Column{Header: "active", ValuePath: "/item[@status='active']/name"}
+	assert.Equal(t, expect, result)
+}
+
+func TestParseColumnSpec_NoneHeader(t *testing.T) {
+
+	// ARRANGE/ACT
+	_, err := parseColumnSpec("=/title")
+
+	// ASSERT
+	require.EqualError(t, err, "invalid column specification '=/title': must be 'header=valuePath'")
+}
+
+func TestGetValue_MissingAndEmpty(t *testing.T) {
+
+	// ARRANGE
+	doc, err := xmlquery.Parse(strings.NewReader(`<item><empty/></item>`))
+	require.NoError(t, err)
+	row := xmlquery.CreateXPathNavigator(xmlquery.FindOne(doc, "//item"))
+
+	// ACT
+	empty, err := getValue(row, "/empty", false)
+	require.NoError(t, err)
+	missing, err := getValue(row, "/missing", false)
+	require.NoError(t, err)
+	evaluated, err := getValue(row, "string(/missing)", true)
+	require.NoError(t, err)
+
+	// ASSERT
+	require.NotNil(t, empty)
+	assert.Equal(t, "", *empty)
+	assert.Nil(t, missing)
+	require.NotNil(t, evaluated)
+	assert.Equal(t, "", *evaluated)
+}
+
+func TestGetColumnValues(t *testing.T) {
+
+	// ARRANGE
+	doc, err := xmlquery.Parse(strings.NewReader(`<item><id>1</id><tag>a</tag><tag>b</tag></item>`))
+	require.NoError(t, err)
+	row := xmlquery.CreateXPathNavigator(xmlquery.FindOne(doc, "//item"))
+
+	columns := []Column{
+		{Header: "id", ValuePath: "/id"},
+		{Header: "tags", ValuePath: "count(/tag)", UseEvaluate: true},
+		{Header: "name", ValuePath: "/name"},
+	}
+
+	exprs, err := compileColumnPaths(columns)
+	require.NoError(t, err)
+
+	// ACT
+	values, err := getColumnValues(row, columns, exprs)
+
+	// ASSERT
+	require.NoError(t, err)
+	require.Len(t, values, 3)
+	assert.Equal(t, "1", *values[0])
+	assert.Equal(t, "2", *values[1])
+	assert.Nil(t, values[2])
+	assert.Nil(t, exprs[1])
+}
+
+func TestCompileColumnPaths_Invalid(t *testing.T) {
+
+	// ARRANGE/ACT
+	_, err := compileColumnPaths([]Column{{Header: "id", ValuePath: "/id["}})
+
+	// ASSERT
+	require.EqualError(t, err, "xpath '/id[' is failed: expression must evaluate to a node-set")
+}
+
+func TestMatchFilter(t *testing.T) {
+
+	// ARRANGE
+	doc, err := xmlquery.Parse(strings.NewReader(`<item><name>a</name><empty/><count>2</count></item>`))
+	require.NoError(t, err)
+	row := xmlquery.CreateXPathNavigator(xmlquery.FindOne(doc, "//item"))
+
+	tests := []struct {
+		filter string
+		expect bool
+	}{
+		{filter: "/name='a'", expect: true},
+		{filter: "/name='b'", expect: false},
+		{filter: "/empty", expect: true},
+		{filter: "/missing", expect: false},
+		{filter: "number(/count)", expect: true},
+		{filter: "number(/count) - 2", expect: false},
+		{filter: "number(/name)", expect: false},
+		{filter: "string(/name)", expect: true},
+		{filter: "string(/empty)", expect: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+
+			// ACT
+			result, err := matchFilter(row, tt.filter)
+
+			// ASSERT
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, result)
+		})
+	}
+}
+
 func TestLoadMapping_File(t *testing.T) {
 
 	// ARRANGE/ACT
@@ -988,6 +2344,160 @@ func TestLoadMapping_URL(t *testing.T) {
 	assert.Equal(t, expect, result)
 }
 
+func TestLoadMapping_YAML(t *testing.T) {
+
+	// ARRANGE/ACT
+	result, err := loadMapping("mapping/rss.yaml")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//item",
+		Columns: []Column{
+			{Header: "title", ValuePath: "/title"},
+			{Header: "link", ValuePath: "/link"},
+			{Header: "description", ValuePath: "/description"},
+		},
+	}
+
+	assert.Equal(t, expect, result)
+}
+
+func TestLoadMapping_TOML(t *testing.T) {
+
+	// ARRANGE/ACT
+	result, err := loadMapping("mapping/rss.toml")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//item",
+		Columns: []Column{
+			{Header: "title", ValuePath: "/title"},
+			{Header: "link", ValuePath: "/link"},
+			{Header: "description", ValuePath: "/description"},
+		},
+	}
+
+	assert.Equal(t, expect, result)
+}
+
+func TestLoadMapping_YAML_WithoutExtension(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mappingPath := createFile(t, temp, "mapping", `
+# comment
+rowsPath: //testcase
+columns:
+  - header: name
+    valuePath: /@name
+  - header: success
+    valuePath: not(/*)
+    useEvaluate: true
+`)
+
+	// ACT
+	result, err := loadMapping(mappingPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//testcase",
+		Columns: []Column{
+			{Header: "name", ValuePath: "/@name"},
+			{Header: "success", ValuePath: "not(/*)", UseEvaluate: true},
+		},
+	}
+
+	assert.Equal(t, expect, result)
+}
+
+func TestLoadMapping_TOML_WithoutExtension(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mappingPath := createFile(t, temp, "mapping", `
+# comment
+rowsPath = "//testcase"
+
+[[columns]]
+header = "name"
+valuePath = "/@name"
+
+[[columns]]
+header = "success"
+valuePath = "not(/*)"
+useEvaluate = true
+`)
+
+	// ACT
+	result, err := loadMapping(mappingPath)
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//testcase",
+		Columns: []Column{
+			{Header: "name", ValuePath: "/@name"},
+			{Header: "success", ValuePath: "not(/*)", UseEvaluate: true},
+		},
+	}
+
+	assert.Equal(t, expect, result)
+}
+
+func TestLoadMapping_InvalidYAML(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mappingPath := createFile(t, temp, "mapping.yml", `
+rowsPath: //item
+columns:
+  - header: [title
+`)
+
+	// ACT
+	_, err := loadMapping(mappingPath)
+
+	// ASSERT
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid mapping format: ")
+}
+
+func TestDetectMappingFormat(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		expect  MappingFormat
+	}{
+		{name: "json extension", path: "mapping.json", content: "rowsPath: //item", expect: MappingFormatJSON},
+		{name: "yaml extension", path: "mapping.yaml", content: "{}", expect: MappingFormatYAML},
+		{name: "yml extension", path: "mapping.YML", content: "{}", expect: MappingFormatYAML},
+		{name: "toml extension", path: "mapping.toml", content: "{}", expect: MappingFormatTOML},
+		{name: "url extension", path: "https://example.com/mapping.yaml?raw=true", content: "{}", expect: MappingFormatYAML},
+		{name: "json content", path: "mapping", content: "\n  {\"rowsPath\": \"//item\"}", expect: MappingFormatJSON},
+		{name: "toml content", path: "mapping", content: "# comment\nrowsPath = \"//item\"", expect: MappingFormatTOML},
+		{name: "toml table content", path: "mapping", content: "[[columns]]\nheader = \"a\"", expect: MappingFormatTOML},
+		{name: "yaml content", path: "mapping", content: "# comment\nrowsPath: //item", expect: MappingFormatYAML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expect, detectMappingFormat(tt.path, []byte(tt.content)))
+		})
+	}
+}
+
 func TestFindXML_Dir(t *testing.T) {
 
 	// ARRANGE/ACT
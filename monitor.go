@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// progressOutput 進捗の出力先
+var progressOutput io.Writer = os.Stderr
+
+// progressInterval 進捗を出力する間隔
+var progressInterval = time.Second
+
+const (
+	StatsFormatText = "text"
+	StatsFormatJSON = "json"
+)
+
+// monitor 変換の進捗と統計を記録
+type monitor struct {
+	headers    []string
+	totalFiles int
+	// totalBytes 入力の合計サイズ(URLが含まれる場合は不明のため-1)
+	totalBytes int64
+	readBytes  atomic.Int64
+	// extracted 制約を満たした、重複の除外や集計の前の行数
+	extracted atomic.Int64
+	// written 出力した行数
+	written   atomic.Int64
+	doneFiles atomic.Int64
+	start     time.Time
+	// files ファイルごとの抽出した行数
+	files []fileStats
+	// emptyValues カラムごとの値が存在しない、もしくは空の数
+	emptyValues []int64
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+type fileStats struct {
+	Path          string `json:"path"`
+	ExtractedRows int64  `json:"extractedRows"`
+}
+
+type columnStats struct {
+	Header      string `json:"header"`
+	EmptyValues int64  `json:"emptyValues"`
+}
+
+// conversionStats 変換の統計
+type conversionStats struct {
+	Files          []fileStats   `json:"files"`
+	ExtractedRows  int64         `json:"extractedRows"`
+	WrittenRows    int64         `json:"writtenRows"`
+	Columns        []columnStats `json:"columns"`
+	ElapsedSeconds float64       `json:"elapsedSeconds"`
+}
+
+// monitorRowWriter 抽出した行を記録
+type monitorRowWriter struct {
+	writer  rowWriter
+	monitor *monitor
+}
+
+// monitorOutputRowWriter 出力した行を記録
+type monitorOutputRowWriter struct {
+	writer  rowWriter
+	monitor *monitor
+}
+
+// monitorReader 読み込んだバイト数を記録
+type monitorReader struct {
+	reader  io.Reader
+	monitor *monitor
+}
+
+func parseStatsFormat(value string) (string, error) {
+
+	switch value {
+	case "", StatsFormatText, StatsFormatJSON:
+		return value, nil
+	}
+
+	return "", fmt.Errorf("stats format must be one of text, json")
+}
+
+func newMonitor(xmlPaths []string, headers []string) *monitor {
+
+	var totalBytes int64
+	for _, xmlPath := range xmlPaths {
+		if isURL(xmlPath) {
+			totalBytes = -1
+			break
+		}
+
+		info, err := os.Stat(xmlPath)
+		if err != nil {
+			// 変換時にエラーとなる
+			continue
+		}
+		totalBytes += info.Size()
+	}
+
+	return &monitor{
+		headers:     headers,
+		totalFiles:  len(xmlPaths),
+		totalBytes:  totalBytes,
+		start:       time.Now(),
+		emptyValues: make([]int64, len(headers)),
+	}
+}
+
+// startProgress writes the progress to the output at the interval until stopProgress is called.
+func (m *monitor) startProgress(output io.Writer) {
+
+	m.stop = make(chan struct{})
+	m.stopped = make(chan struct{})
+
+	go func() {
+		defer close(m.stopped)
+
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// 同じ行を上書き
+				fmt.Fprintf(output, "\r%s", m.progress())
+			case <-m.stop:
+				fmt.Fprintf(output, "\r%s\n", m.progress())
+				return
+			}
+		}
+	}()
+}
+
+func (m *monitor) stopProgress() {
+
+	if m.stop == nil {
+		return
+	}
+
+	close(m.stop)
+	<-m.stopped
+	m.stop = nil
+}
+
+// progress returns the progress as bytes read, rows extracted and written, files and throughput.
+func (m *monitor) progress() string {
+
+	readBytes := m.readBytes.Load()
+
+	read := formatSize(readBytes)
+	if m.totalBytes > 0 {
+		read = fmt.Sprintf("%s / %s (%.1f%%)", read, formatSize(m.totalBytes), float64(readBytes)*100/float64(m.totalBytes))
+	}
+
+	throughput := int64(0)
+	if elapsed := time.Since(m.start).Seconds(); elapsed > 0 {
+		throughput = int64(float64(readBytes) / elapsed)
+	}
+
+	return fmt.Sprintf("%s, %d rows extracted, %d rows written, %d/%d files, %s/s",
+		read, m.extracted.Load(), m.written.Load(), m.doneFiles.Load(), m.totalFiles, formatSize(throughput))
+}
+
+func (m *monitor) beginFile(path string) {
+	m.files = append(m.files, fileStats{Path: path})
+}
+
+func (m *monitor) endFile() {
+	m.doneFiles.Add(1)
+}
+
+func (m *monitor) wrapReader(reader io.Reader) io.Reader {
+	return &monitorReader{reader: reader, monitor: m}
+}
+
+// wrapWriter records the rows extracted, before they are deduplicated or aggregated.
+func (m *monitor) wrapWriter(writer rowWriter) rowWriter {
+	return &monitorRowWriter{writer: writer, monitor: m}
+}
+
+// wrapOutput records the rows written to the output.
+func (m *monitor) wrapOutput(writer rowWriter) rowWriter {
+	return &monitorOutputRowWriter{writer: writer, monitor: m}
+}
+
+func (m *monitor) stats() conversionStats {
+
+	stats := conversionStats{
+		Files:          m.files,
+		ExtractedRows:  m.extracted.Load(),
+		WrittenRows:    m.written.Load(),
+		ElapsedSeconds: time.Since(m.start).Seconds(),
+	}
+	if stats.Files == nil {
+		stats.Files = []fileStats{}
+	}
+
+	for i, header := range m.headers {
+		stats.Columns = append(stats.Columns, columnStats{Header: header, EmptyValues: m.emptyValues[i]})
+	}
+
+	return stats
+}
+
+// printStats writes the summary of the conversion as text or JSON.
+func (m *monitor) printStats(output io.Writer, statsFormat string) error {
+
+	stats := m.stats()
+
+	if statsFormat == StatsFormatJSON {
+		encoded, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(output, string(encoded))
+		return err
+	}
+
+	fmt.Fprintf(output, "Files: %d\n", len(stats.Files))
+	for _, file := range stats.Files {
+		fmt.Fprintf(output, "  %s: %d rows extracted\n", file.Path, file.ExtractedRows)
+	}
+	fmt.Fprintf(output, "Rows extracted: %d\n", stats.ExtractedRows)
+	fmt.Fprintf(output, "Rows written: %d\n", stats.WrittenRows)
+	fmt.Fprintln(output, "Empty values:")
+	for _, column := range stats.Columns {
+		fmt.Fprintf(output, "  %s: %d\n", column.Header, column.EmptyValues)
+	}
+	_, err := fmt.Fprintf(output, "Elapsed: %s\n", time.Duration(stats.ElapsedSeconds*float64(time.Second)).Round(time.Millisecond))
+
+	return err
+}
+
+func (w *monitorRowWriter) Write(values []*string) error {
+
+	m := w.monitor
+	m.extracted.Add(1)
+	if len(m.files) > 0 {
+		m.files[len(m.files)-1].ExtractedRows++
+	}
+
+	for i, value := range values {
+		if i < len(m.emptyValues) && (value == nil || *value == "") {
+			m.emptyValues[i]++
+		}
+	}
+
+	return w.writer.Write(values)
+}
+
+func (w *monitorRowWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+func (w *monitorOutputRowWriter) Write(values []*string) error {
+
+	if err := w.writer.Write(values); err != nil {
+		return err
+	}
+	w.monitor.written.Add(1)
+
+	return nil
+}
+
+func (w *monitorOutputRowWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+func (r *monitorReader) Read(p []byte) (int, error) {
+
+	n, err := r.reader.Read(p)
+	r.monitor.readBytes.Add(int64(n))
+
+	return n, err
+}
+
+// formatSize formats the bytes with the unit (B, KB, MB, GB) same as the size specification.
+func formatSize(bytes int64) string {
+
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	}
+
+	return fmt.Sprintf("%d B", bytes)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createMonitorInput(t *testing.T) string {
+
+	inputDir := filepath.Join(t.TempDir(), "input")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	createFile(t, inputDir, "1.xml", `<root><item><id>1</id><name>a</name></item><item><id>2</id><name></name></item></root>`)
+	createFile(t, inputDir, "2.xml", `<root><item><id>3</id></item></root>`)
+
+	return inputDir
+}
+
+func TestRun_Stats(t *testing.T) {
+
+	// ARRANGE
+	inputDir := createMonitorInput(t)
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputDir,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "name=/name",
+			"-o", filepath.Join(t.TempDir(), "output.csv"),
+			"--stats",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	lines := strings.Split(out.String(), "\n")
+	expect := []string{
+		"Files: 2",
+		fmt.Sprintf("  %s: 2 rows extracted", filepath.Join(inputDir, "1.xml")),
+		fmt.Sprintf("  %s: 1 rows extracted", filepath.Join(inputDir, "2.xml")),
+		"Rows extracted: 3",
+		"Rows written: 3",
+		"Empty values:",
+		"  id: 0",
+		"  name: 2",
+	}
+	assert.Equal(t, expect, lines[:len(expect)])
+	assert.Regexp(t, `^Elapsed: [0-9.]+m?s$`, lines[len(expect)])
+	assert.Equal(t, "", lines[len(expect)+1])
+}
+
+func TestRun_Stats_JSON(t *testing.T) {
+
+	// ARRANGE
+	inputDir := createMonitorInput(t)
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputDir,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "name=/name",
+			"-o", filepath.Join(t.TempDir(), "output.csv"),
+			"--where", "/id != 2",
+			"--stats=json",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	var stats conversionStats
+	require.NoError(t, json.Unmarshal(out.Bytes(), &stats))
+
+	// 出力した行のみ対象
+	assert.Equal(t, []fileStats{
+		{Path: filepath.Join(inputDir, "1.xml"), ExtractedRows: 1},
+		{Path: filepath.Join(inputDir, "2.xml"), ExtractedRows: 1},
+	}, stats.Files)
+	assert.Equal(t, int64(2), stats.ExtractedRows)
+	assert.Equal(t, int64(2), stats.WrittenRows)
+	assert.Equal(t, []columnStats{
+		{Header: "id", EmptyValues: 0},
+		{Header: "name", EmptyValues: 1},
+	}, stats.Columns)
+	assert.GreaterOrEqual(t, stats.ElapsedSeconds, 0.0)
+}
+
+func TestRun_Stats_Distinct(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root><item><id>1</id></item><item><id>2</id></item><item><id>1</id></item></root>`)
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"distinct": {},
+		"columns": [
+			{
+				"header": "id",
+				"valuePath": "/id"
+			}
+		]
+	}`)
+
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", filepath.Join(temp, "output.csv"),
+			"--sort-by", "id",
+			"--stats=json",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	var stats conversionStats
+	require.NoError(t, json.Unmarshal(out.Bytes(), &stats))
+
+	// 重複の除外前に抽出した行と、除外後に出力した行を分けて記録
+	assert.Equal(t, []fileStats{{Path: inputPath, ExtractedRows: 3}}, stats.Files)
+	assert.Equal(t, int64(3), stats.ExtractedRows)
+	assert.Equal(t, int64(2), stats.WrittenRows)
+}
+
+func TestRun_Stats_Invalid(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", filepath.Join(t.TempDir(), "output.csv"),
+			"--stats=yaml",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "Invalid stats specification: stats format must be one of text, json\n", out.String())
+}
+
+func TestRun_Progress(t *testing.T) {
+
+	// ARRANGE
+	inputDir := createMonitorInput(t)
+	out := new(bytes.Buffer)
+
+	progress := new(bytes.Buffer)
+	defaultOutput, defaultInterval := progressOutput, progressInterval
+	progressOutput, progressInterval = progress, time.Millisecond
+	defer func() {
+		progressOutput, progressInterval = defaultOutput, defaultInterval
+	}()
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputDir,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-o", filepath.Join(t.TempDir(), "output.csv"),
+			"--progress",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// 最後に全体の進捗を出力して改行
+	lines := strings.Split(progress.String(), "\r")
+	assert.Regexp(t, regexp.MustCompile(`^[0-9]+ B / [0-9]+ B \(100\.0%\), 3 rows extracted, 3 rows written, 2/2 files, [0-9.]+ [KMG]?B/s\n$`), lines[len(lines)-1])
+}
+
+func TestMonitor_Progress(t *testing.T) {
+
+	// ARRANGE
+	m := &monitor{totalFiles: 3, totalBytes: 4 * 1024 * 1024, start: time.Now().Add(-2 * time.Second)}
+	m.readBytes.Store(1024 * 1024)
+	m.extracted.Store(100)
+	m.written.Store(80)
+	m.doneFiles.Store(1)
+
+	// ACT
+	result := m.progress()
+
+	// ASSERT
+	assert.Regexp(t, `^1\.0 MB / 4\.0 MB \(25\.0%\), 100 rows extracted, 80 rows written, 1/3 files, 5[0-9]{2}\.[0-9] KB/s$`, result)
+}
+
+func TestMonitor_Progress_UnknownTotal(t *testing.T) {
+
+	// ARRANGE
+	m := newMonitor([]string{"testdata/rss.xml", "https://example.com/a.xml"}, []string{"id"})
+	m.readBytes.Store(10)
+
+	// ACT
+	result := m.progress()
+
+	// ASSERT
+	assert.Regexp(t, `^10 B, 0 rows extracted, 0 rows written, 0/2 files, `, result)
+}
+
+func TestFormatSize(t *testing.T) {
+
+	assert.Equal(t, "0 B", formatSize(0))
+	assert.Equal(t, "1023 B", formatSize(1023))
+	assert.Equal(t, "1.5 KB", formatSize(1536))
+	assert.Equal(t, "10.0 MB", formatSize(10*1024*1024))
+	assert.Equal(t, "2.5 GB", formatSize(5*1024*1024*1024/2))
+}
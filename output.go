@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/onozaty/go-customcsv"
+)
+
+// OutputFormat 出力ファイルの形式
+type OutputFormat string
+
+const (
+	OutputFormatAuto OutputFormat = ""
+	OutputFormatCSV  OutputFormat = "csv"
+	OutputFormatJSON OutputFormat = "json"
+	// OutputFormatFixed カラムの幅を揃えた固定長(ヘッダは無し)
+	OutputFormatFixed OutputFormat = "fixed"
+)
+
+// rowWriter 行の出力先(値がnilの場合は該当するノードが存在しない)
+type rowWriter interface {
+	Write(values []*string) error
+	Flush() error
+}
+
+type csvRowWriter struct {
+	writer *csvWriter
+}
+
+// jsonRowWriter ヘッダをキーとしたオブジェクトの配列として出力
+type jsonRowWriter struct {
+	writer  *bufio.Writer
+	headers []string
+	rows    int
+}
+
+func parseOutputFormat(value string) (OutputFormat, error) {
+
+	switch OutputFormat(strings.ToLower(value)) {
+	case OutputFormatAuto:
+		return OutputFormatAuto, nil
+	case OutputFormatCSV:
+		return OutputFormatCSV, nil
+	case OutputFormatJSON:
+		return OutputFormatJSON, nil
+	case OutputFormatFixed:
+		return OutputFormatFixed, nil
+	}
+
+	return "", fmt.Errorf("output format must be one of csv, json, fixed")
+}
+
+// resolveOutputFormat returns the specified format, or determines it from the extension.
+func resolveOutputFormat(path string, outputFormat OutputFormat) OutputFormat {
+
+	if outputFormat != OutputFormatAuto {
+		return outputFormat
+	}
+
+	if extension(path) == ".json" {
+		return OutputFormatJSON
+	}
+
+	return OutputFormatCSV
+}
+
+// newRowWriter creates the writer for the output format, and writes the header and the descriptions.
+func newRowWriter(writer io.Writer, headers []string, format Format) (rowWriter, error) {
+
+	headers = formatHeaders(headers, format)
+
+	if format.OutputFormat == OutputFormatJSON {
+		return newJSONRowWriter(writer, headers)
+	}
+
+	if format.OutputFormat == OutputFormatFixed {
+		if format.WithBom {
+			// BOMを付与
+			if _, err := writer.Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+				return nil, err
+			}
+		}
+		return newFixedWidthRowWriter(writer, format), nil
+	}
+
+	csvWriter, err := newCSVWriter(writer, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if !format.WithoutHeader {
+		if err := csvWriter.Write(headers); err != nil {
+			return nil, err
+		}
+
+		if format.Descriptions != nil {
+			if err := csvWriter.Write(format.Descriptions); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &csvRowWriter{writer: csvWriter}, nil
+}
+
+// openAppend opens the output file to append the rows.
+// If the file exists and is not empty, its header must match the headers, and true is returned to skip writing the header.
+// Without the header, the existing file is not checked.
+func openAppend(path string, headers []string, format Format) (*os.File, bool, error) {
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && info.Size() == 0) {
+		file, err := os.Create(path)
+		return file, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !format.WithoutHeader {
+		if err := checkHeader(path, formatHeaders(headers, format), format); err != nil {
+			return nil, false, err
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	return file, true, err
+}
+
+// checkHeader checks that the header of the existing file matches the headers.
+func checkHeader(path string, headers []string, format Format) error {
+
+	existing, err := readHeader(path, format.Delimiter, format.QuoteChar)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(existing, headers) {
+		return fmt.Errorf("%s cannot be appended: header '%s' does not match '%s'",
+			path, strings.Join(existing, string(format.Delimiter)), strings.Join(headers, string(format.Delimiter)))
+	}
+
+	return nil
+}
+
+func readHeader(path string, delimiter rune, quote rune) ([]string, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	csvReader := customcsv.NewReader(file)
+	csvReader.Delimiter = delimiter
+	if quote != 0 {
+		csvReader.Quote = quote
+	}
+
+	headers, err := csvReader.Read()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s is failed: %w", path, err)
+	}
+
+	// BOMは除いて比較
+	if len(headers) > 0 {
+		headers[0] = strings.TrimPrefix(headers[0], "\uFEFF")
+	}
+
+	return headers, nil
+}
+
+func (w *csvRowWriter) Write(values []*string) error {
+
+	return w.writer.writeValues(values)
+}
+
+func (w *csvRowWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+func newJSONRowWriter(writer io.Writer, headers []string) (*jsonRowWriter, error) {
+
+	w := &jsonRowWriter{writer: bufio.NewWriter(writer), headers: headers}
+	if _, err := w.writer.WriteString("["); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *jsonRowWriter) Write(values []*string) error {
+
+	separator := ",\n  "
+	if w.rows == 0 {
+		separator = "\n  "
+	}
+	w.rows++
+
+	if _, err := w.writer.WriteString(separator + "{"); err != nil {
+		return err
+	}
+
+	// ヘッダの順序を保つため、オブジェクトは個別に組み立てる
+	for i, header := range w.headers {
+		if i > 0 {
+			if _, err := w.writer.WriteString(", "); err != nil {
+				return err
+			}
+		}
+
+		key, err := marshalJSON(header)
+		if err != nil {
+			return err
+		}
+
+		// nilはnullとして出力
+		var value *string
+		if i < len(values) {
+			value = values[i]
+		}
+		encoded, err := marshalJSON(value)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w.writer, "%s: %s", key, encoded); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.writer.WriteString("}")
+	return err
+}
+
+func (w *jsonRowWriter) Flush() error {
+
+	closing := "]\n"
+	if w.rows > 0 {
+		closing = "\n]\n"
+	}
+
+	if _, err := w.writer.WriteString(closing); err != nil {
+		return err
+	}
+
+	return w.writer.Flush()
+}
+
+// marshalJSON encodes the value without escaping HTML characters.
+func marshalJSON(value any) ([]byte, error) {
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	ProfileFormatTable = "table"
+	ProfileFormatJSON  = "json"
+)
+
+// profiler カラムごとの値の傾向を集計
+type profiler struct {
+	rows    int64
+	columns []*columnProfiler
+}
+
+type columnProfiler struct {
+	header    string
+	filled    int64
+	minLength int
+	maxLength int
+	// numeric 空以外の値が全て数値か
+	numeric  bool
+	min      float64
+	max      float64
+	distinct *hyperLogLog
+	top      *topK
+}
+
+// profileReport 集計結果
+type profileReport struct {
+	Rows    int64           `json:"rows"`
+	Columns []columnProfile `json:"columns"`
+}
+
+type columnProfile struct {
+	Header   string  `json:"header"`
+	Filled   int64   `json:"filled"`
+	FillRate float64 `json:"fillRate"`
+	// Distinct 異なる値の数(推定値)
+	Distinct  uint64 `json:"distinct"`
+	MinLength *int   `json:"minLength"`
+	MaxLength *int   `json:"maxLength"`
+	// Min 全て数値の場合の最小値
+	Min *float64 `json:"min"`
+	// Max 全て数値の場合の最大値
+	Max *float64 `json:"max"`
+	// Top 出現回数の多い値(推定値)
+	Top []valueCount `json:"top"`
+}
+
+func runProfile(arguments []string, output io.Writer) int {
+
+	var xmlPath string
+	var inputFormat string
+	var mappingPath string
+	var rowsPath string
+	var where string
+	var columnSpecs []string
+	var reportPath string
+	var reportFormat string
+	var top int
+	var help bool
+
+	flagSet := flag.NewFlagSet("xml2csv profile", flag.ContinueOnError)
+
+	flagSet.StringVarP(&xmlPath, "input", "i", "", "XML input file path or directory or url")
+	flagSet.StringVar(&inputFormat, "input-format", "", "(optional) Input format (xml, json, html) (default determined by extension)")
+	flagSet.StringVarP(&mappingPath, "mapping", "m", "", "XML to CSV mapping file path or url")
+	flagSet.StringVarP(&rowsPath, "rows", "r", "", "(optional) XPath to get as a rows (overrides rowsPath in mapping)")
+	flagSet.StringVar(&where, "where", "", "(optional) XPath expression to filter rows (overrides filter in mapping)")
+	flagSet.StringArrayVarP(&columnSpecs, "column", "c", nil, "(optional) Column as 'header=valuePath' ('!eval' suffix for useEvaluate), repeatable")
+	flagSet.StringVarP(&reportPath, "output", "o", "", "(optional) Report output file path (default stdout)")
+	flagSet.StringVar(&reportFormat, "format", ProfileFormatTable, "(optional) Report format (table, json)")
+	flagSet.IntVar(&top, "top", 5, "(optional) Number of the most frequent values to report")
+	flagSet.BoolVarP(&help, "help", "h", false, "Help")
+
+	flagSet.SortFlags = false
+	flagSet.Usage = func() {
+		fmt.Fprintf(output, "xml2csv v%s (%s)\n\n", Version, Commit)
+		fmt.Fprint(output, "Usage: xml2csv profile [flags]\n\nFlags\n")
+		flagSet.PrintDefaults()
+		fmt.Fprintln(output)
+	}
+	flagSet.SetOutput(output)
+
+	if err := flagSet.Parse(arguments); err != nil {
+		flagSet.Usage()
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	parsedInputFormat, err := parseInputFormat(inputFormat)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid input format specification:", err)
+		return NG
+	}
+
+	if reportFormat != ProfileFormatTable && reportFormat != ProfileFormatJSON {
+		fmt.Fprintln(output, "Invalid format specification: format must be one of table, json")
+		return NG
+	}
+
+	if help {
+		flagSet.Usage()
+		return OK
+	}
+
+	if xmlPath == "" || top < 0 || (mappingPath == "" && (rowsPath == "" || len(columnSpecs) == 0)) {
+		flagSet.Usage()
+		return NG
+	}
+
+	mapping, err := buildMapping(mappingPath, rowsPath, where, columnSpecs)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	xmlPaths, err := findXML(xmlPath)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	report, err := profile(xmlPaths, mapping, parsedInputFormat, top)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	reportOutput := output
+	if reportPath != "" {
+		reportFile, err := os.Create(reportPath)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+		defer reportFile.Close()
+
+		reportOutput = reportFile
+	}
+
+	if reportFormat == ProfileFormatJSON {
+		err = report.writeJSON(reportOutput)
+	} else {
+		err = report.writeTable(reportOutput)
+	}
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	return OK
+}
+
+// profile reads the rows of the mapping, and reports the values of each column.
+// Duplicates and aggregation in the mapping are not applied.
+func profile(xmlPaths []string, mapping *Mapping, inputFormat InputFormat, top int) (*profileReport, error) {
+
+	p := newProfiler(mapping.Columns, top)
+	for _, xmlPath := range xmlPaths {
+		if err := convertOne(xmlPath, mapping, Format{InputFormat: inputFormat}, p); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.report(top), nil
+}
+
+func newProfiler(columns []Column, top int) *profiler {
+
+	p := &profiler{}
+	for _, column := range columns {
+		p.columns = append(p.columns, &columnProfiler{
+			header:   column.Header,
+			numeric:  true,
+			distinct: newHyperLogLog(),
+			top:      newTopK(top),
+		})
+	}
+
+	return p
+}
+
+func (p *profiler) Write(values []*string) error {
+
+	p.rows++
+	for i, value := range values {
+		if value != nil && *value != "" {
+			p.columns[i].add(*value)
+		}
+	}
+
+	return nil
+}
+
+func (p *profiler) Flush() error {
+	return nil
+}
+
+func (p *profiler) report(top int) *profileReport {
+
+	report := &profileReport{Rows: p.rows, Columns: []columnProfile{}}
+	for _, column := range p.columns {
+		report.Columns = append(report.Columns, column.profile(p.rows, top))
+	}
+
+	return report
+}
+
+func (c *columnProfiler) add(value string) {
+
+	c.filled++
+
+	length := utf8.RuneCountInString(value)
+	if c.filled == 1 || length < c.minLength {
+		c.minLength = length
+	}
+	if c.filled == 1 || length > c.maxLength {
+		c.maxLength = length
+	}
+
+	if c.numeric {
+		// NaNやInfはParseFloatでは数値となるが、統計には使えないため数値とみなさない
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || !numericPattern.MatchString(value) {
+			c.numeric = false
+		} else {
+			if c.filled == 1 || number < c.min {
+				c.min = number
+			}
+			if c.filled == 1 || number > c.max {
+				c.max = number
+			}
+		}
+	}
+
+	c.distinct.add(value)
+	c.top.add(value)
+}
+
+func (c *columnProfiler) profile(rows int64, top int) columnProfile {
+
+	profile := columnProfile{
+		Header:   c.header,
+		Filled:   c.filled,
+		Distinct: c.distinct.count(),
+		Top:      c.top.top(top),
+	}
+
+	if rows > 0 {
+		profile.FillRate = float64(c.filled) / float64(rows)
+	}
+
+	if c.filled > 0 {
+		profile.MinLength = &c.minLength
+		profile.MaxLength = &c.maxLength
+
+		if c.numeric {
+			profile.Min = &c.min
+			profile.Max = &c.max
+		}
+	}
+
+	return profile
+}
+
+func (r *profileReport) writeJSON(writer io.Writer) error {
+
+	encoded, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(writer, string(encoded))
+	return err
+}
+
+func (r *profileReport) writeTable(writer io.Writer) error {
+
+	fmt.Fprintf(writer, "Rows: %d\n\n", r.Rows)
+
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "header\tfilled\tfill rate\tdistinct\tmin length\tmax length\tmin\tmax\ttop values")
+
+	for _, column := range r.Columns {
+		top := "-"
+		if len(column.Top) > 0 {
+			var counts []string
+			for _, count := range column.Top {
+				counts = append(counts, fmt.Sprintf("%q (%d)", count.Value, count.Count))
+			}
+			top = strings.Join(counts, ", ")
+		}
+
+		fmt.Fprintf(table, "%s\t%d\t%.1f%%\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			column.Header,
+			column.Filled,
+			column.FillRate*100,
+			column.Distinct,
+			formatOptional(column.MinLength, strconv.Itoa),
+			formatOptional(column.MaxLength, strconv.Itoa),
+			formatOptional(column.Min, formatNumber),
+			formatOptional(column.Max, formatNumber),
+			top)
+	}
+
+	return table.Flush()
+}
+
+// formatOptional formats the value, or returns '-' if it is not available.
+func formatOptional[T any](value *T, format func(T) string) string {
+
+	if value == nil {
+		return "-"
+	}
+
+	return format(*value)
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const profileInput = `<root>
+<item><id>1</id><name>apple</name><price>100</price></item>
+<item><id>2</id><name>りんご</name><price>1.5</price></item>
+<item><id>3</id><name>apple</name><price>-20</price></item>
+<item><id>4</id><name></name><price>free</price></item>
+</root>`
+
+func TestRun_Profile(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputPath := createFile(t, temp, "input.xml", profileInput)
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"profile",
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "name=/name",
+			"-c", "price=/price",
+			"-c", "memo=/memo",
+			"--top", "2",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	expect := `Rows: 4
+
+header  filled  fill rate  distinct  min length  max length  min  max  top values
+id      4       100.0%     4         1           1           1    4    "1" (1), "2" (1)
+name    3       75.0%      2         3           5           -    -    "apple" (2), "りんご" (1)
+price   4       100.0%     4         3           4           -    -    "-20" (1), "1.5" (1)
+memo    0       0.0%       0         -           -           -    -    -
+`
+	assert.Equal(t, expect, out.String())
+}
+
+func TestRun_Profile_JSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputPath := createFile(t, temp, "input.xml", profileInput)
+	reportPath := filepath.Join(temp, "report.json")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"profile",
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "price=/price",
+			"--where", "/price != 'free'",
+			"--format", "json",
+			"-o", reportPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	var report profileReport
+	require.NoError(t, json.Unmarshal([]byte(readString(t, reportPath)), &report))
+
+	minLength, maxLength := 3, 3
+	minValue, maxValue := -20.0, 100.0
+	expect := profileReport{
+		Rows: 3,
+		Columns: []columnProfile{
+			{
+				Header:    "price",
+				Filled:    3,
+				FillRate:  1,
+				Distinct:  3,
+				MinLength: &minLength,
+				MaxLength: &maxLength,
+				Min:       &minValue,
+				Max:       &maxValue,
+				Top: []valueCount{
+					{Value: "-20", Count: 1},
+					{Value: "1.5", Count: 1},
+					{Value: "100", Count: 1},
+				},
+			},
+		},
+	}
+	assert.Equal(t, expect, report)
+}
+
+func TestRun_Profile_NonFinite(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputPath := createFile(t, temp, "input.xml", `<root>
+<item><value>1</value></item>
+<item><value>NaN</value></item>
+<item><value>+Inf</value></item>
+<item><value>1e400</value></item>
+</root>`)
+
+	arguments := []string{
+		"profile",
+		"-i", inputPath,
+		"-r", "//item",
+		"-c", "value=/value",
+	}
+
+	// ACT
+	tableOut := new(bytes.Buffer)
+	tableExitCode := run(arguments, tableOut)
+
+	reportPath := filepath.Join(temp, "report.json")
+	jsonOut := new(bytes.Buffer)
+	jsonExitCode := run(append(arguments, "--format", "json", "-o", reportPath), jsonOut)
+
+	// ASSERT
+	// NaNやInfを含む列は数値とみなさない
+	require.Equal(t, OK, tableExitCode)
+
+	expect := `Rows: 4
+
+header  filled  fill rate  distinct  min length  max length  min  max  top values
+value   4       100.0%     4         1           5           -    -    "+Inf" (1), "1" (1), "1e400" (1), "NaN" (1)
+`
+	assert.Equal(t, expect, tableOut.String())
+
+	require.Equal(t, OK, jsonExitCode)
+	require.Empty(t, jsonOut.String())
+
+	var report profileReport
+	require.NoError(t, json.Unmarshal([]byte(readString(t, reportPath)), &report))
+	require.Len(t, report.Columns, 1)
+	assert.Nil(t, report.Columns[0].Min)
+	assert.Nil(t, report.Columns[0].Max)
+}
+
+func TestRun_Profile_InvalidFormat(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"profile",
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"--format", "csv",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "Invalid format specification: format must be one of table, json\n", out.String())
+}
+
+func TestHyperLogLog(t *testing.T) {
+
+	tests := []int{0, 1, 10, 1000, 100000}
+
+	for _, n := range tests {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+
+			// ARRANGE
+			h := newHyperLogLog()
+
+			// ACT
+			for i := 0; i < n; i++ {
+				// 重複した値は数えない
+				h.add(fmt.Sprintf("value%d", i))
+				h.add(fmt.Sprintf("value%d", i))
+			}
+
+			// ASSERT
+			assert.InDelta(t, n, h.count(), float64(n)*0.03)
+		})
+	}
+}
+
+func TestTopK(t *testing.T) {
+
+	// ARRANGE
+	topK := newTopK(2)
+
+	// ACT
+	// 保持できる数を超える種類の値があっても、出現回数の多い値は残る
+	for i := 0; i < 1000; i++ {
+		topK.add(fmt.Sprintf("rare%d", i))
+		if i%2 == 0 {
+			topK.add("frequent1")
+		}
+		if i%4 == 0 {
+			topK.add("frequent2")
+		}
+	}
+
+	// ASSERT
+	top := topK.top(2)
+	require.Len(t, top, 2)
+	assert.Equal(t, "frequent1", top[0].Value)
+	assert.Equal(t, "frequent2", top[1].Value)
+	assert.GreaterOrEqual(t, top[0].Count, int64(500))
+	assert.GreaterOrEqual(t, top[1].Count, int64(250))
+}
+
+func TestTopK_Replace(t *testing.T) {
+
+	// ARRANGE
+	topK := &topK{capacity: 3, counters: map[string]*topKCounter{}}
+
+	// ACT
+	for _, value := range []string{"a", "a", "a", "b", "b", "c", "d", "d"} {
+		topK.add(value)
+	}
+
+	// ASSERT
+	// 最も少ないcを置き換え、cの回数を引き継ぐ
+	assert.Equal(t, []valueCount{{Value: "a", Count: 3}, {Value: "d", Count: 3}, {Value: "b", Count: 2}}, topK.top(3))
+}
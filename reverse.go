@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/onozaty/go-customcsv"
+
+	flag "github.com/spf13/pflag"
+)
+
+// xmlNamePattern 名前空間の宣言は出力しないため、プレフィックスの無い名前のみ
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// xmlNode 逆変換で生成する要素
+type xmlNode struct {
+	name       string
+	attributes []xml.Attr
+	text       string
+	children   []*xmlNode
+}
+
+// simplePath 子要素と属性のみで構成されるパス(どちらも無い場合は行の要素自身のテキスト)
+type simplePath struct {
+	elements  []string
+	attribute string
+}
+
+func runCSV2XML(arguments []string, output io.Writer) int {
+
+	var csvPath string
+	var mappingPath string
+	var xmlPath string
+	var rootName string
+	var delimiter string
+	var help bool
+
+	flagSet := flag.NewFlagSet("xml2csv csv2xml", flag.ContinueOnError)
+
+	flagSet.StringVarP(&csvPath, "input", "i", "", "CSV input file path or url")
+	flagSet.StringVarP(&mappingPath, "mapping", "m", "", "XML to CSV mapping file path or url")
+	flagSet.StringVarP(&xmlPath, "output", "o", "", "XML output file path")
+	flagSet.StringVar(&rootName, "root", "root", "(optional) Root element name when rowsPath starts with '//'")
+	flagSet.StringVarP(&delimiter, "delimiter", "d", ",", "(optional) CSV input delimiter (e.g. ';' or '\\t' for tab)")
+	flagSet.BoolVarP(&help, "help", "h", false, "Help")
+
+	flagSet.SortFlags = false
+	flagSet.Usage = func() {
+		fmt.Fprintf(output, "xml2csv v%s (%s)\n\n", Version, Commit)
+		fmt.Fprint(output, "Usage: xml2csv csv2xml [flags]\n\nFlags\n")
+		flagSet.PrintDefaults()
+		fmt.Fprintln(output)
+	}
+	flagSet.SetOutput(output)
+
+	if err := flagSet.Parse(arguments); err != nil {
+		flagSet.Usage()
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	delimiterRune, err := getDelimiterRune(delimiter)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid delimiter specification:", err)
+		return NG
+	}
+
+	if help {
+		flagSet.Usage()
+		return OK
+	}
+
+	if csvPath == "" || mappingPath == "" || xmlPath == "" {
+		flagSet.Usage()
+		return NG
+	}
+
+	mapping, err := loadMapping(mappingPath)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	if err := validateReverseMapping(mapping); err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	reader, err := open(csvPath)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+	defer reader.Close()
+
+	xmlFile, err := os.Create(xmlPath)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+	defer xmlFile.Close()
+
+	if err := reverseConvert(reader, mapping, xmlFile, delimiterRune, rootName); err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	return OK
+}
+
+// validateReverseMapping checks that the mapping can be converted from CSV back to XML.
+func validateReverseMapping(mapping *Mapping) error {
+
+	if _, _, err := parseReverseRowsPath(mapping.RowsPath, "root"); err != nil {
+		return err
+	}
+
+	for _, column := range mapping.Columns {
+		if column.UseEvaluate {
+			return fmt.Errorf("column '%s' cannot be converted to XML: useEvaluate is not invertible", column.Header)
+		}
+
+		if len(column.Transforms) != 0 {
+			return fmt.Errorf("column '%s' cannot be converted to XML: transforms are not invertible", column.Header)
+		}
+
+		if _, err := parseSimplePath(column.ValuePath); err != nil {
+			return fmt.Errorf("column '%s' cannot be converted to XML: %w", column.Header, err)
+		}
+	}
+
+	return nil
+}
+
+// reverseConvert converts CSV to XML according to the mapping.
+func reverseConvert(reader io.Reader, mapping *Mapping, writer io.Writer, delimiter rune, rootName string) error {
+
+	containers, rowName, err := parseReverseRowsPath(mapping.RowsPath, rootName)
+	if err != nil {
+		return err
+	}
+
+	csvReader := customcsv.NewReader(reader)
+	csvReader.Delimiter = delimiter
+
+	headers, err := csvReader.Read()
+	if err == io.EOF {
+		return fmt.Errorf("CSV header is not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	// BOMは除いて比較
+	headers[0] = strings.TrimPrefix(headers[0], "\uFEFF")
+
+	// CSVのヘッダとマッピングのカラムを対応付け
+	paths := make([]*simplePath, len(headers))
+	for i, header := range headers {
+		for _, column := range mapping.Columns {
+			if column.Header == header {
+				path, err := parseSimplePath(column.ValuePath)
+				if err != nil {
+					return fmt.Errorf("column '%s' cannot be converted to XML: %w", column.Header, err)
+				}
+				paths[i] = path
+				break
+			}
+		}
+
+		if paths[i] == nil {
+			return fmt.Errorf("CSV header '%s' is not a column of the mapping", header)
+		}
+	}
+
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", "  ")
+
+	for _, container := range containers {
+		if err := encoder.EncodeToken(xml.StartElement{Name: xml.Name{Local: container}}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		values, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		row := &xmlNode{name: rowName}
+		for i, value := range values {
+			if i < len(paths) && paths[i] != nil && value != "" {
+				row.set(paths[i], value)
+			}
+		}
+
+		if err := row.encode(encoder); err != nil {
+			return err
+		}
+	}
+
+	for i := len(containers) - 1; i >= 0; i-- {
+		if err := encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: containers[i]}}); err != nil {
+			return err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(writer, "\n")
+	return err
+}
+
+// parseReverseRowsPath returns the names of the container elements and the row element.
+// '//item' is created under the root element, '/rss/channel/item' is created as it is.
+func parseReverseRowsPath(rowsPath string, rootName string) ([]string, string, error) {
+
+	var names []string
+	elementsPath := rowsPath
+	if strings.HasPrefix(rowsPath, "//") {
+		names = append(names, rootName)
+		elementsPath = strings.TrimPrefix(rowsPath, "/")
+	}
+
+	path, err := parseSimplePath(elementsPath)
+	if err != nil || path.attribute != "" || !strings.HasPrefix(elementsPath, "/") {
+		return nil, "", fmt.Errorf("rowsPath '%s' cannot be converted to XML: must be a simple element path", rowsPath)
+	}
+	names = append(names, path.elements...)
+
+	if len(names) < 2 {
+		return nil, "", fmt.Errorf("rowsPath '%s' cannot be converted to XML: must have a parent element", rowsPath)
+	}
+
+	return names[:len(names)-1], names[len(names)-1], nil
+}
+
+// parseSimplePath parses the path consisting only of child elements and an attribute (e.g. '/author/name', '/link/@href').
+// '.' is the text of the row element itself.
+func parseSimplePath(valuePath string) (*simplePath, error) {
+
+	if valuePath == "." {
+		return &simplePath{}, nil
+	}
+
+	steps := strings.Split(strings.TrimPrefix(valuePath, "/"), "/")
+
+	path := &simplePath{}
+	for i, step := range steps {
+		if strings.Contains(step, ":") {
+			return nil, fmt.Errorf("'%s' has a namespace prefix, which cannot be declared in the output", valuePath)
+		}
+
+		if strings.HasPrefix(step, "@") && i == len(steps)-1 {
+			step = strings.TrimPrefix(step, "@")
+			if !xmlNamePattern.MatchString(step) {
+				return nil, fmt.Errorf("'%s' is not a simple child or attribute path", valuePath)
+			}
+			path.attribute = step
+			break
+		}
+
+		if !xmlNamePattern.MatchString(step) {
+			return nil, fmt.Errorf("'%s' is not a simple child or attribute path", valuePath)
+		}
+		path.elements = append(path.elements, step)
+	}
+
+	return path, nil
+}
+
+// set materializes the path under the node and sets the value.
+func (n *xmlNode) set(path *simplePath, value string) {
+
+	node := n
+	for _, name := range path.elements {
+		node = node.child(name)
+	}
+
+	if path.attribute != "" {
+		node.attributes = append(node.attributes, xml.Attr{Name: xml.Name{Local: path.attribute}, Value: value})
+	} else {
+		node.text = value
+	}
+}
+
+func (n *xmlNode) child(name string) *xmlNode {
+
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+	}
+
+	child := &xmlNode{name: name}
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *xmlNode) encode(encoder *xml.Encoder) error {
+
+	start := xml.StartElement{Name: xml.Name{Local: n.name}, Attr: n.attributes}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if n.text != "" {
+		if err := encoder.EncodeToken(xml.CharData(n.text)); err != nil {
+			return err
+		}
+	}
+
+	for _, child := range n.children {
+		if err := child.encode(encoder); err != nil {
+			return err
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCSV2XML(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.csv", joinRows(
+		"title,link",
+		"RSS Tutorial,https://www.w3schools.com/xml/xml_rss.asp",
+		"\"XML <Tutorial>\",",
+	))
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{
+				"header": "title",
+				"valuePath": "/title"
+			},
+			{
+				"header": "link",
+				"valuePath": "/link"
+			}
+		]
+	}`)
+
+	outputPath := filepath.Join(temp, "output.xml")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"csv2xml",
+			"-i", inputPath,
+			"-m", mappingPath,
+			"-o", outputPath,
+			"--root", "items",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<items>
+  <item>
+    <title>RSS Tutorial</title>
+    <link>https://www.w3schools.com/xml/xml_rss.asp</link>
+  </item>
+  <item>
+    <title>XML &lt;Tutorial&gt;</title>
+  </item>
+</items>
+`
+	assert.Equal(t, expect, result)
+}
+
+func TestRunCSV2XML_RoundTrip(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<orders>
+	<order id="1">
+		<customer><name>Taro</name><mail type="work">taro@example.com</mail></customer>
+		<amount currency="JPY">100</amount>
+	</order>
+	<order id="2">
+		<customer><name>Hanako</name></customer>
+		<amount currency="USD">2.5</amount>
+	</order>
+	</orders>`)
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "/orders/order",
+		"columns": [
+			{ "header": "id", "valuePath": "/@id" },
+			{ "header": "name", "valuePath": "/customer/name" },
+			{ "header": "mail", "valuePath": "/customer/mail" },
+			{ "header": "mail_type", "valuePath": "/customer/mail/@type" },
+			{ "header": "amount", "valuePath": "/amount" },
+			{ "header": "currency", "valuePath": "/amount/@currency" }
+		]
+	}`)
+
+	csvPath := filepath.Join(temp, "output.csv")
+	xmlPath := filepath.Join(temp, "output.xml")
+	roundTripPath := filepath.Join(temp, "roundtrip.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run([]string{"-i", inputPath, "-m", mappingPath, "-o", csvPath}, out)
+	require.Equal(t, OK, exitCode)
+
+	exitCode = run([]string{"csv2xml", "-i", csvPath, "-m", mappingPath, "-o", xmlPath}, out)
+	require.Equal(t, OK, exitCode)
+
+	exitCode = run([]string{"-i", xmlPath, "-m", mappingPath, "-o", roundTripPath}, out)
+	require.Equal(t, OK, exitCode)
+
+	// ASSERT
+	require.Empty(t, out.String())
+
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<orders>
+  <order id="1">
+    <customer>
+      <name>Taro</name>
+      <mail type="work">taro@example.com</mail>
+    </customer>
+    <amount currency="JPY">100</amount>
+  </order>
+  <order id="2">
+    <customer>
+      <name>Hanako</name>
+    </customer>
+    <amount currency="USD">2.5</amount>
+  </order>
+</orders>
+`
+	assert.Equal(t, expect, readString(t, xmlPath))
+	assert.Equal(t, readString(t, csvPath), readString(t, roundTripPath))
+}
+
+func TestRunCSV2XML_UseEvaluate(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.csv", joinRows("name,success", "test1,true"))
+	outputPath := filepath.Join(temp, "output.xml")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"csv2xml",
+			"-i", inputPath,
+			"-m", "mapping/junit.json",
+			"-o", outputPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "column 'success' cannot be converted to XML: useEvaluate is not invertible\n", out.String())
+}
+
+func TestValidateReverseMapping_NotSimplePath(t *testing.T) {
+
+	// ARRANGE
+	mapping := &Mapping{
+		RowsPath: "//item",
+		Columns: []Column{
+			{Header: "title", ValuePath: "/title"},
+			{Header: "first", ValuePath: "/tag[1]"},
+		},
+	}
+
+	// ACT
+	err := validateReverseMapping(mapping)
+
+	// ASSERT
+	require.EqualError(t, err, "column 'first' cannot be converted to XML: '/tag[1]' is not a simple child or attribute path")
+}
+
+func TestValidateReverseMapping_RowsPathWithoutParent(t *testing.T) {
+
+	// ARRANGE
+	mapping := &Mapping{
+		RowsPath: "/item",
+		Columns: []Column{
+			{Header: "title", ValuePath: "/title"},
+		},
+	}
+
+	// ACT
+	err := validateReverseMapping(mapping)
+
+	// ASSERT
+	require.EqualError(t, err, "rowsPath '/item' cannot be converted to XML: must have a parent element")
+}
+
+func TestValidateReverseMapping_RowsPathNotSimple(t *testing.T) {
+
+	// ARRANGE
+	mapping := &Mapping{
+		RowsPath: "//item[@id]",
+	}
+
+	// ACT
+	err := validateReverseMapping(mapping)
+
+	// ASSERT
+	require.EqualError(t, err, "rowsPath '//item[@id]' cannot be converted to XML: must be a simple element path")
+}
+
+func TestReverseConvert_UnknownHeader(t *testing.T) {
+
+	// ARRANGE
+	mapping := &Mapping{
+		RowsPath: "//item",
+		Columns: []Column{
+			{Header: "title", ValuePath: "/title"},
+		},
+	}
+
+	input := strings.NewReader(joinRows("title;other", "a;b"))
+	output := new(bytes.Buffer)
+
+	// ACT
+	err := reverseConvert(input, mapping, output, ';', "root")
+
+	// ASSERT
+	require.EqualError(t, err, "CSV header 'other' is not a column of the mapping")
+}
+
+func TestReverseConvert_BOMAndRowText(t *testing.T) {
+
+	// ARRANGE
+	mapping := &Mapping{
+		RowsPath: "//price",
+		Columns: []Column{
+			{Header: "price", ValuePath: "."},
+			{Header: "currency", ValuePath: "/@currency"},
+		},
+	}
+
+	input := strings.NewReader(joinRows("\uFEFFprice,currency", "100,JPY", "2.5,"))
+	output := new(bytes.Buffer)
+
+	// ACT
+	err := reverseConvert(input, mapping, output, ',', "prices")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// '.'は行の要素自身のテキスト
+	expect := `<?xml version="1.0" encoding="UTF-8"?>
+<prices>
+  <price currency="JPY">100</price>
+  <price>2.5</price>
+</prices>
+`
+	assert.Equal(t, expect, output.String())
+}
+
+func TestValidateReverseMapping_Prefix(t *testing.T) {
+
+	// ARRANGE
+	mapping := &Mapping{
+		RowsPath: "//item",
+		Columns: []Column{
+			{Header: "creator", ValuePath: "/dc:creator"},
+		},
+	}
+
+	// ACT
+	err := validateReverseMapping(mapping)
+
+	// ASSERT
+	require.EqualError(t, err, "column 'creator' cannot be converted to XML: '/dc:creator' has a namespace prefix, which cannot be declared in the output")
+}
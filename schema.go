@@ -0,0 +1,731 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// maxViolations エラーメッセージに含める違反の最大数
+const maxViolations = 10
+
+const (
+	OnInvalidFileError = "error"
+	OnInvalidFileSkip  = "skip"
+)
+
+var (
+	xsdDecimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+	xsdFloatPattern   = regexp.MustCompile(`^([+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?|-?INF|NaN)$`)
+	xsdTimezone       = regexp.MustCompile(`(Z|[+-]\d{2}:\d{2})$`)
+	xsdFraction       = regexp.MustCompile(`\.\d+$`)
+)
+
+// 整数型の範囲(符号付きのビット数)
+var xsdIntegerBits = map[string]uint{
+	"long":  64,
+	"int":   32,
+	"short": 16,
+	"byte":  8,
+}
+
+// 整数型の範囲(符号無しのビット数)
+var xsdUnsignedBits = map[string]uint{
+	"unsignedLong":  64,
+	"unsignedInt":   32,
+	"unsignedShort": 16,
+	"unsignedByte":  8,
+}
+
+// schemaValidator XSDで入力を検証(よく使われる構成要素のみ対応)
+type schemaValidator struct {
+	schema   *xsdSchema
+	models   map[*xsdComplexType]*contentModel
+	patterns map[string]*regexp.Regexp
+}
+
+// contentModel 複合型の要素に含められる子要素、属性、テキスト
+type contentModel struct {
+	children map[string]*childRule
+	// childOrder 子要素の宣言順(必須の子要素のエラーを順序通りにするため)
+	childOrder []string
+	anyElement bool
+	attributes []*xsdAttribute
+	// anyAttribute 宣言されていない属性を許可
+	anyAttribute bool
+	// text 単純内容の型(nilの場合はテキストを持たない)
+	text  *simpleTypeRule
+	mixed bool
+}
+
+// childRule 子要素の宣言と出現回数
+type childRule struct {
+	element   *xsdElement
+	minOccurs int
+	// maxOccurs 最大の出現回数(-1は無制限)
+	maxOccurs int
+}
+
+// simpleTypeRule 組み込み型と、派生で加えられた制約
+type simpleTypeRule struct {
+	// builtin 組み込み型(空の場合は検証しない)
+	builtin      string
+	restrictions []*xsdRestriction
+}
+
+// validationFrame 検証中の要素
+type validationFrame struct {
+	name string
+	line int
+	// model 複合型の内容(nilの場合は単純型もしくは任意の内容)
+	model *contentModel
+	// simple 単純型の値(nilかつmodelもnilの場合は検証しない)
+	simple  *simpleTypeRule
+	counts  map[string]int
+	text    strings.Builder
+	hasText bool
+}
+
+// schemaError 入力がスキーマに適合しないことを示すエラー(--on-invalid-file skip で読み飛ばす)
+type schemaError struct {
+	path       string
+	violations []string
+	total      int
+}
+
+// validateFiles validates the files against the schema, and returns the valid files and the invalid files.
+// If skipping, the invalid files are reported to the output and excluded instead of returning the error.
+func validateFiles(xmlPaths []string, validator *schemaValidator, inputFormat InputFormat, skip bool, output io.Writer) ([]string, []string, error) {
+
+	var validPaths []string
+	var invalidPaths []string
+	for _, xmlPath := range xmlPaths {
+		if resolveInputFormat(xmlPath, inputFormat) != InputFormatXML {
+			return nil, nil, fmt.Errorf("%s is not XML, the schema can be used only with XML input", xmlPath)
+		}
+
+		err := validator.validateFile(xmlPath)
+		if err != nil {
+			var schemaErr *schemaError
+			if !skip || !errors.As(err, &schemaErr) {
+				return nil, nil, err
+			}
+
+			fmt.Fprintf(output, "skipped: %v\n", err)
+			invalidPaths = append(invalidPaths, xmlPath)
+			continue
+		}
+
+		validPaths = append(validPaths, xmlPath)
+	}
+
+	return validPaths, invalidPaths, nil
+}
+
+func newSchemaValidator(schema *xsdSchema) *schemaValidator {
+
+	return &schemaValidator{
+		schema:   schema,
+		models:   map[*xsdComplexType]*contentModel{},
+		patterns: map[string]*regexp.Regexp{},
+	}
+}
+
+// validateFile validates the file against the schema.
+// If the file does not conform to the schema, a schemaError with the line numbers is returned.
+func (v *schemaValidator) validateFile(path string) error {
+
+	reader, err := open(path)
+	if err != nil {
+		return fmt.Errorf("%s is failed: %w", path, err)
+	}
+	defer reader.Close()
+
+	violations, total, err := v.validate(reader)
+	if err != nil {
+		return fmt.Errorf("%s is failed: %w", path, err)
+	}
+	if total > 0 {
+		return &schemaError{path: path, violations: violations, total: total}
+	}
+
+	return nil
+}
+
+// validate reads the XML as a stream, and returns the violations (up to maxViolations) and the total number of them.
+func (v *schemaValidator) validate(reader io.Reader) ([]string, int, error) {
+
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var violations []string
+	total := 0
+	report := func(line int, format string, args ...any) {
+		total++
+		if len(violations) < maxViolations {
+			violations = append(violations, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+		}
+	}
+
+	var stack []*validationFrame
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				report(syntaxErr.Line, "%s", syntaxErr.Msg)
+				break
+			}
+			return nil, 0, err
+		}
+
+		line, _ := decoder.InputPos()
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+
+			var element *xsdElement
+			if len(stack) == 0 {
+				if element = v.schema.element(name); element == nil {
+					report(line, "root element '%s' is not declared in the schema", name)
+				}
+			} else if parent := stack[len(stack)-1]; parent.model != nil {
+				element = v.child(parent, name, line, report)
+			} else if parent.simple != nil {
+				report(line, "element '%s' is not allowed in element '%s'", name, parent.name)
+			}
+
+			frame := v.newFrame(name, line, element)
+			if err := v.validateAttributes(frame, t.Attr, report); err != nil {
+				return nil, 0, err
+			}
+			stack = append(stack, frame)
+
+		case xml.CharData:
+			if len(stack) == 0 {
+				continue
+			}
+			frame := stack[len(stack)-1]
+			if frame.simple != nil || (frame.model != nil && frame.model.text != nil) {
+				frame.text.Write(t)
+			} else if strings.TrimSpace(string(t)) != "" {
+				frame.hasText = true
+			}
+
+		case xml.EndElement:
+			frame := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if err := v.validateEnd(frame, report); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	return violations, total, nil
+}
+
+// child returns the declaration of the child element, and reports it if it is not allowed.
+func (v *schemaValidator) child(parent *validationFrame, name string, line int, report func(int, string, ...any)) *xsdElement {
+
+	rule, found := parent.model.children[name]
+	if !found {
+		if !parent.model.anyElement {
+			report(line, "element '%s' is not allowed in element '%s'", name, parent.name)
+		}
+		return nil
+	}
+
+	parent.counts[name]++
+	if rule.maxOccurs >= 0 && parent.counts[name] > rule.maxOccurs {
+		report(line, "element '%s' occurs more than %d times in element '%s'", name, rule.maxOccurs, parent.name)
+	}
+
+	return rule.element
+}
+
+func (v *schemaValidator) newFrame(name string, line int, element *xsdElement) *validationFrame {
+
+	frame := &validationFrame{name: name, line: line, counts: map[string]int{}}
+	if element == nil {
+		// 宣言されていない要素の内容は検証しない
+		return frame
+	}
+
+	if complexType := v.schema.complexTypeOf(element); complexType != nil {
+		frame.model = v.contentModel(complexType)
+		return frame
+	}
+
+	if (element.Type == "" && element.SimpleType == nil) || localName(element.Type) == "anyType" {
+		// 任意の内容
+		return frame
+	}
+
+	frame.simple = v.simpleType(element.Type, element.SimpleType)
+	return frame
+}
+
+func (v *schemaValidator) validateAttributes(frame *validationFrame, attributes []xml.Attr, report func(int, string, ...any)) error {
+
+	if frame.simple != nil {
+		for _, attribute := range attributes {
+			if !isNamespaceAttribute(attribute.Name) {
+				report(frame.line, "attribute '%s' is not allowed in element '%s'", attribute.Name.Local, frame.name)
+			}
+		}
+		return nil
+	}
+
+	if frame.model == nil {
+		return nil
+	}
+
+	values := map[string]string{}
+	for _, attribute := range attributes {
+		if isNamespaceAttribute(attribute.Name) {
+			continue
+		}
+		values[attribute.Name.Local] = attribute.Value
+	}
+
+	declared := map[string]bool{}
+	for _, declaration := range frame.model.attributes {
+		name := declaration.Name
+		if declaration.Ref != "" {
+			name = localName(declaration.Ref)
+		}
+		declared[name] = true
+
+		value, found := values[name]
+		if !found {
+			if declaration.Use == "required" {
+				report(frame.line, "attribute '%s' is required in element '%s'", name, frame.name)
+			}
+			continue
+		}
+
+		message, err := v.validateValue(v.simpleType(declaration.Type, declaration.SimpleType), value)
+		if err != nil {
+			return err
+		}
+		if message != "" {
+			report(frame.line, "attribute '%s' of element '%s': %s", name, frame.name, message)
+		}
+	}
+
+	if !frame.model.anyAttribute {
+		for _, attribute := range attributes {
+			if !isNamespaceAttribute(attribute.Name) && !declared[attribute.Name.Local] {
+				report(frame.line, "attribute '%s' is not allowed in element '%s'", attribute.Name.Local, frame.name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateEnd validates the value and the required children when the element ends.
+func (v *schemaValidator) validateEnd(frame *validationFrame, report func(int, string, ...any)) error {
+
+	rule := frame.simple
+	if frame.model != nil {
+		rule = frame.model.text
+
+		for _, name := range frame.model.childOrder {
+			if child := frame.model.children[name]; frame.counts[name] < child.minOccurs {
+				report(frame.line, "element '%s' is required in element '%s'", name, frame.name)
+			}
+		}
+
+		if rule == nil && frame.hasText && !frame.model.mixed {
+			report(frame.line, "text is not allowed in element '%s'", frame.name)
+		}
+	}
+
+	if rule == nil {
+		return nil
+	}
+
+	message, err := v.validateValue(rule, frame.text.String())
+	if err != nil {
+		return err
+	}
+	if message != "" {
+		report(frame.line, "element '%s': %s", frame.name, message)
+	}
+
+	return nil
+}
+
+// contentModel flattens the model groups of the complex type into the children and their occurrences.
+// The order of the children in a sequence is not validated.
+func (v *schemaValidator) contentModel(complexType *xsdComplexType) *contentModel {
+
+	if model, found := v.models[complexType]; found {
+		return model
+	}
+
+	model := &contentModel{
+		children:     map[string]*childRule{},
+		attributes:   v.schema.attributesOf(complexType),
+		anyAttribute: complexType.AnyAttribute != nil,
+		mixed:        complexType.Mixed,
+	}
+	v.models[complexType] = model
+
+	if complexType.SimpleContent != nil {
+		model.text = v.simpleContentType(complexType)
+	}
+
+	for _, group := range v.schema.groupsOf(complexType) {
+		v.addGroup(model, group, 1, 1)
+	}
+
+	return model
+}
+
+func (v *schemaValidator) addGroup(model *contentModel, group *xsdGroup, minFactor int, maxFactor int) {
+
+	minFactor *= occurs(group.MinOccurs, 1)
+	maxFactor = multiplyOccurs(maxFactor, maxOccurs(group.MaxOccurs))
+
+	// choiceの場合はいずれか1つのため、各要素は必須ではない
+	if group.XMLName.Local == "choice" && len(group.Elements)+len(group.Sequences)+len(group.Choices) > 1 {
+		minFactor = 0
+	}
+
+	if len(group.Any) > 0 {
+		model.anyElement = true
+	}
+
+	for _, element := range group.Elements {
+		declaration := element
+		if element.Ref != "" {
+			if declaration = v.schema.element(element.Ref); declaration == nil {
+				continue
+			}
+		}
+
+		name := declaration.Name
+		rule, found := model.children[name]
+		if !found {
+			rule = &childRule{element: declaration}
+			model.children[name] = rule
+			model.childOrder = append(model.childOrder, name)
+		}
+
+		// 同じ要素が複数回宣言されている場合は回数を合算
+		rule.minOccurs += minFactor * occurs(element.MinOccurs, 1)
+		rule.maxOccurs = addOccurs(rule.maxOccurs, multiplyOccurs(maxFactor, maxOccurs(element.MaxOccurs)), found)
+	}
+
+	for _, child := range append(group.Sequences, group.Choices...) {
+		v.addGroup(model, child, minFactor, maxFactor)
+	}
+}
+
+// simpleContentType resolves the type of the text of the complex type with the simple content.
+func (v *schemaValidator) simpleContentType(complexType *xsdComplexType) *simpleTypeRule {
+
+	for depth := 0; depth < 100 && complexType != nil && complexType.SimpleContent != nil; depth++ {
+		base := complexType.SimpleContent.base()
+		baseType := v.schema.complexType(base)
+		if baseType == nil || baseType == complexType {
+			return v.simpleType(base, nil)
+		}
+		complexType = baseType
+	}
+
+	return &simpleTypeRule{}
+}
+
+// simpleType resolves the type name (or the inline simple type) to the built-in type and the restrictions.
+func (v *schemaValidator) simpleType(typeName string, simpleType *xsdSimpleType) *simpleTypeRule {
+
+	rule := &simpleTypeRule{}
+
+	for depth := 0; depth < 100; depth++ {
+		if simpleType != nil {
+			if simpleType.Restriction == nil {
+				// list, union は検証しない
+				return &simpleTypeRule{}
+			}
+			rule.restrictions = append(rule.restrictions, simpleType.Restriction)
+			typeName = simpleType.Restriction.Base
+			simpleType = nil
+			continue
+		}
+
+		if typeName == "" {
+			return rule
+		}
+
+		for _, named := range v.schema.SimpleTypes {
+			if named.Name == localName(typeName) {
+				simpleType = named
+				break
+			}
+		}
+		if simpleType != nil {
+			continue
+		}
+
+		if _, found := xsdBuiltinTypes[localName(typeName)]; found {
+			rule.builtin = localName(typeName)
+		}
+		return rule
+	}
+
+	return rule
+}
+
+// validateValue returns the message if the value is not valid, or empty if it is valid.
+func (v *schemaValidator) validateValue(rule *simpleTypeRule, value string) (string, error) {
+
+	// 文字列以外は前後の空白を除いて扱う
+	if columnType := xsdBuiltinTypes[rule.builtin]; columnType != "" && columnType != "string" {
+		value = strings.TrimSpace(value)
+	}
+
+	if rule.builtin != "" && !isValidBuiltin(rule.builtin, value) {
+		return fmt.Sprintf("'%s' is not a valid %s", value, rule.builtin), nil
+	}
+
+	for _, restriction := range rule.restrictions {
+		message, err := v.validateRestriction(restriction, value)
+		if err != nil || message != "" {
+			return message, err
+		}
+	}
+
+	return "", nil
+}
+
+func (v *schemaValidator) validateRestriction(restriction *xsdRestriction, value string) (string, error) {
+
+	if len(restriction.Enumerations) > 0 {
+		var allowed []string
+		for _, enumeration := range restriction.Enumerations {
+			if enumeration.Value == value {
+				allowed = nil
+				break
+			}
+			allowed = append(allowed, enumeration.Value)
+		}
+		if allowed != nil {
+			return fmt.Sprintf("'%s' is not one of %s", value, strings.Join(allowed, ", ")), nil
+		}
+	}
+
+	if len(restriction.Patterns) > 0 {
+		// 同じ派生での複数のパターンはいずれかに一致すればよい
+		matched := false
+		for _, pattern := range restriction.Patterns {
+			compiled, err := v.pattern(pattern.Value)
+			if err != nil {
+				return "", err
+			}
+			if compiled.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Sprintf("'%s' does not match pattern '%s'", value, restriction.Patterns[0].Value), nil
+		}
+	}
+
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		if restriction.MinInclusive != nil && !compareFacet(number, restriction.MinInclusive, func(n, f float64) bool { return n >= f }) {
+			return fmt.Sprintf("'%s' is less than %s", value, restriction.MinInclusive.Value), nil
+		}
+		if restriction.MaxInclusive != nil && !compareFacet(number, restriction.MaxInclusive, func(n, f float64) bool { return n <= f }) {
+			return fmt.Sprintf("'%s' is greater than %s", value, restriction.MaxInclusive.Value), nil
+		}
+		if restriction.MinExclusive != nil && !compareFacet(number, restriction.MinExclusive, func(n, f float64) bool { return n > f }) {
+			return fmt.Sprintf("'%s' is not greater than %s", value, restriction.MinExclusive.Value), nil
+		}
+		if restriction.MaxExclusive != nil && !compareFacet(number, restriction.MaxExclusive, func(n, f float64) bool { return n < f }) {
+			return fmt.Sprintf("'%s' is not less than %s", value, restriction.MaxExclusive.Value), nil
+		}
+	}
+
+	length := utf8.RuneCountInString(value)
+	if restriction.Length != nil && strconv.Itoa(length) != restriction.Length.Value {
+		return fmt.Sprintf("'%s' is not %s characters", value, restriction.Length.Value), nil
+	}
+	if restriction.MinLength != nil {
+		if minLength, err := strconv.Atoi(restriction.MinLength.Value); err == nil && length < minLength {
+			return fmt.Sprintf("'%s' is shorter than %d characters", value, minLength), nil
+		}
+	}
+	if restriction.MaxLength != nil {
+		if maxLength, err := strconv.Atoi(restriction.MaxLength.Value); err == nil && length > maxLength {
+			return fmt.Sprintf("'%s' is longer than %d characters", value, maxLength), nil
+		}
+	}
+
+	return "", nil
+}
+
+// pattern compiles the XSD pattern, which matches the whole value.
+func (v *schemaValidator) pattern(pattern string) (*regexp.Regexp, error) {
+
+	if compiled, found := v.patterns[pattern]; found {
+		return compiled, nil
+	}
+
+	compiled, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("pattern '%s' in schema is not supported: %w", pattern, err)
+	}
+	v.patterns[pattern] = compiled
+
+	return compiled, nil
+}
+
+func (e *schemaError) Error() string {
+
+	message := fmt.Sprintf("%s is invalid against the schema:\n  %s", e.path, strings.Join(e.violations, "\n  "))
+	if e.total > len(e.violations) {
+		message += fmt.Sprintf("\n  ... and %d more", e.total-len(e.violations))
+	}
+
+	return message
+}
+
+func isValidBuiltin(builtin string, value string) bool {
+
+	switch xsdBuiltinTypes[builtin] {
+	case "integer":
+		return isValidInteger(builtin, value)
+	case "number":
+		if builtin == "decimal" {
+			return xsdDecimalPattern.MatchString(value)
+		}
+		return xsdFloatPattern.MatchString(value)
+	case "boolean":
+		return value == "true" || value == "false" || value == "1" || value == "0"
+	case "date":
+		return isValidDateTime("2006-01-02", value)
+	case "datetime":
+		return isValidDateTime("2006-01-02T15:04:05", value)
+	case "time":
+		return isValidDateTime("15:04:05", value)
+	}
+
+	return true
+}
+
+func isValidInteger(builtin string, value string) bool {
+
+	number, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return false
+	}
+
+	if bits, found := xsdIntegerBits[builtin]; found {
+		limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+		return number.Cmp(new(big.Int).Neg(limit)) >= 0 && number.Cmp(limit) < 0
+	}
+	if bits, found := xsdUnsignedBits[builtin]; found {
+		return number.Sign() >= 0 && number.Cmp(new(big.Int).Lsh(big.NewInt(1), bits)) < 0
+	}
+
+	switch builtin {
+	case "nonNegativeInteger":
+		return number.Sign() >= 0
+	case "positiveInteger":
+		return number.Sign() > 0
+	case "nonPositiveInteger":
+		return number.Sign() <= 0
+	case "negativeInteger":
+		return number.Sign() < 0
+	}
+
+	return true
+}
+
+// isValidDateTime checks the value with the layout, allowing the fractional seconds and the timezone.
+func isValidDateTime(layout string, value string) bool {
+
+	value = xsdTimezone.ReplaceAllString(value, "")
+	value = xsdFraction.ReplaceAllString(value, "")
+
+	_, err := time.Parse(layout, value)
+	return err == nil
+}
+
+func compareFacet(number float64, facet *xsdFacet, compare func(n, f float64) bool) bool {
+
+	limit, err := strconv.ParseFloat(facet.Value, 64)
+	if err != nil {
+		// 数値以外の制約(日付など)は検証しない
+		return true
+	}
+
+	return compare(number, limit)
+}
+
+// isNamespaceAttribute returns true for the namespace declarations and the attributes with a namespace such as xsi:type.
+func isNamespaceAttribute(name xml.Name) bool {
+	return name.Space != "" || name.Local == "xmlns"
+}
+
+func occurs(value string, defaultValue int) int {
+
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+
+	return n
+}
+
+func maxOccurs(value string) int {
+
+	if value == "unbounded" {
+		return -1
+	}
+
+	return occurs(value, 1)
+}
+
+func multiplyOccurs(a int, b int) int {
+
+	if a < 0 || b < 0 {
+		return -1
+	}
+
+	return a * b
+}
+
+func addOccurs(a int, b int, found bool) int {
+
+	if !found {
+		return b
+	}
+	if a < 0 || b < 0 {
+		return -1
+	}
+
+	return a + b
+}
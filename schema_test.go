@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validOrders = `<?xml version="1.0" encoding="UTF-8"?>
+<orders>
+  <order id="1">
+    <orderedAt>2024-01-02T10:00:00Z</orderedAt>
+    <customer><name>Taro</name><birthday>2000-01-31</birthday></customer>
+    <amount currency="JPY"> 100.5 </amount>
+    <status>active</status>
+    <paid>true</paid>
+  </order>
+</orders>`
+
+const invalidOrders = `<?xml version="1.0" encoding="UTF-8"?>
+<orders>
+  <order id="x" extra="1">
+    <orderedAt>2024-13-02T10:00:00</orderedAt>
+    <customer><birthday>2000-01-31</birthday></customer>
+    <amount currency="JPY">abc</amount>
+    <status>open</status>
+    <paid>true</paid>
+    <note>hello</note>
+  </order>
+</orders>`
+
+func TestRun_Schema(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputPath := createFile(t, temp, "input.xml", validOrders)
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//order",
+			"-c", "id=/@id",
+			"-c", "amount=/amount",
+			"-o", outputPath,
+			"--schema", "testdata/xsd/orders.xsd",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	assert.Equal(t, joinRows("id,amount", "1, 100.5 "), readString(t, outputPath))
+}
+
+func TestRun_Schema_Invalid(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputPath := createFile(t, temp, "input.xml", invalidOrders)
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//order",
+			"-c", "id=/@id",
+			"-o", outputPath,
+			"--schema", "testdata/xsd/orders.xsd",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := fmt.Sprintf(`%s is invalid against the schema:
+  line 3: attribute 'id' of element 'order': 'x' is not a valid int
+  line 3: attribute 'extra' is not allowed in element 'order'
+  line 4: element 'orderedAt': '2024-13-02T10:00:00' is not a valid dateTime
+  line 5: element 'name' is required in element 'customer'
+  line 6: element 'amount': 'abc' is not a valid decimal
+  line 7: element 'status': 'open' is not one of active, closed
+  line 9: element 'note' is not allowed in element 'order'
+`, inputPath)
+	assert.Equal(t, expect, out.String())
+
+	// 変換前に検証するため出力されない
+	assert.NoFileExists(t, outputPath)
+}
+
+func TestRun_Schema_Skip(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "input")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	createFile(t, inputDir, "1.xml", validOrders)
+	invalidPath := createFile(t, inputDir, "2.xml", `<orders><order id="2"></orders>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	statePath := filepath.Join(temp, "state.json")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputDir,
+			"-r", "//order",
+			"-c", "id=/@id",
+			"-o", outputPath,
+			"--schema", "testdata/xsd/orders.xsd",
+			"--on-invalid-file", "skip",
+			"--append",
+			"--state", statePath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	expect := fmt.Sprintf("skipped: %s is invalid against the schema:\n  line 1: element <order> closed by </orders>\n", invalidPath)
+	assert.Equal(t, expect, out.String())
+
+	assert.Equal(t, joinRows("id", "1"), readString(t, outputPath))
+
+	// 読み飛ばしたファイルは状態に記録しない
+	state, err := loadState(statePath)
+	require.NoError(t, err)
+	assert.Len(t, state.Files, 1)
+}
+
+func TestRun_Schema_NotXML(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/json/items.json",
+			"-r", "//items/*",
+			"-c", "id=/id",
+			"-o", filepath.Join(t.TempDir(), "output.csv"),
+			"--schema", "testdata/xsd/orders.xsd",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "testdata/json/items.json is not XML, the schema can be used only with XML input\n", out.String())
+}
+
+func TestRun_Schema_InvalidOnInvalidFile(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", filepath.Join(t.TempDir(), "output.csv"),
+			"--on-invalid-file", "ignore",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "Invalid on-invalid-file specification: must be one of error, skip\n", out.String())
+}
+
+func TestSchemaValidator_Validate(t *testing.T) {
+
+	schemaContent := `<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:simpleType name="codeType">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="[A-Z]{2}\d+"/>
+      <xs:maxLength value="5"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:simpleType name="scoreType">
+    <xs:restriction base="xs:integer">
+      <xs:minInclusive value="0"/>
+      <xs:maxExclusive value="100"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:element name="items">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="item" maxOccurs="unbounded">
+          <xs:complexType>
+            <xs:sequence>
+              <xs:element name="code" type="codeType"/>
+              <xs:choice>
+                <xs:element name="score" type="scoreType"/>
+                <xs:element name="grade" type="xs:string"/>
+              </xs:choice>
+              <xs:element name="tag" type="xs:string" minOccurs="0" maxOccurs="2"/>
+              <xs:element name="extension" minOccurs="0">
+                <xs:complexType>
+                  <xs:sequence>
+                    <xs:any processContents="skip" maxOccurs="unbounded"/>
+                  </xs:sequence>
+                  <xs:anyAttribute/>
+                </xs:complexType>
+              </xs:element>
+            </xs:sequence>
+          </xs:complexType>
+        </xs:element>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`
+
+	tests := []struct {
+		name   string
+		input  string
+		expect []string
+	}{
+		{
+			name:   "valid",
+			input:  `<items><item><code>AB1</code><grade>A</grade><tag>x</tag><tag>y</tag><extension a="1"><x><y/></x></extension></item></items>`,
+			expect: nil,
+		},
+		{
+			name:   "pattern",
+			input:  `<items><item><code>ab1</code><score>1</score></item></items>`,
+			expect: []string{`line 1: element 'code': 'ab1' does not match pattern '[A-Z]{2}\d+'`},
+		},
+		{
+			name:   "length",
+			input:  `<items><item><code>AB1234</code><score>1</score></item></items>`,
+			expect: []string{`line 1: element 'code': 'AB1234' is longer than 5 characters`},
+		},
+		{
+			name: "range",
+			input: `<items>
+<item><code>AB1</code><score>-1</score></item>
+<item><code>AB1</code><score>100</score></item>
+<item><code>AB1</code><score>1.5</score></item>
+</items>`,
+			expect: []string{
+				`line 2: element 'score': '-1' is less than 0`,
+				`line 3: element 'score': '100' is not less than 100`,
+				`line 4: element 'score': '1.5' is not a valid integer`,
+			},
+		},
+		{
+			name:   "occurs",
+			input:  `<items><item><code>AB1</code><tag>x</tag><tag>y</tag><tag>z</tag></item></items>`,
+			expect: []string{`line 1: element 'tag' occurs more than 2 times in element 'item'`},
+		},
+		{
+			name:   "root",
+			input:  `<products/>`,
+			expect: []string{`line 1: root element 'products' is not declared in the schema`},
+		},
+		{
+			name:   "syntax",
+			input:  "<items>\n<item>\n</items>",
+			expect: []string{`line 3: element <item> closed by </items>`},
+		},
+	}
+
+	temp := t.TempDir()
+	schema, err := loadXSD(createFile(t, temp, "schema.xsd", schemaContent))
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			validator := newSchemaValidator(schema)
+
+			// ACT
+			violations, total, err := validator.validate(strings.NewReader(tt.input))
+
+			// ASSERT
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, violations)
+			assert.Equal(t, len(tt.expect), total)
+		})
+	}
+}
+
+func TestSchemaValidator_ValidateFile_ManyViolations(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputPath := createFile(t, temp, "input.xml", "<orders>\n"+strings.Repeat("<order/>\n", 12)+"</orders>")
+
+	schema, err := loadXSD("testdata/xsd/orders.xsd")
+	require.NoError(t, err)
+
+	// ACT
+	err = newSchemaValidator(schema).validateFile(inputPath)
+
+	// ASSERT
+	// 必須の属性と子要素(5つ)で各6件の違反
+	require.Error(t, err)
+
+	lines := strings.Split(err.Error(), "\n")
+	assert.Len(t, lines, 1+maxViolations+1)
+	assert.Equal(t, "  line 2: attribute 'id' is required in element 'order'", lines[1])
+	assert.Equal(t, fmt.Sprintf("  ... and %d more", 12*6-maxViolations), lines[len(lines)-1])
+}
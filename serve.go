@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// errorTrailer 出力を開始した後に発生したエラーを返すトレーラー
+const errorTrailer = "Xml2csv-Error"
+
+// mappingNamePattern マッピング名として使える文字(ディレクトリ外のファイルを参照させない)
+var mappingNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.\-]*$`)
+
+// server 変換をHTTPのAPIとして提供
+type server struct {
+	// mappingDir 名前で指定するマッピングファイルのディレクトリ
+	mappingDir string
+	// maxSize リクエストボディの最大サイズ
+	maxSize int64
+	// timeout リクエストごとのタイムアウト
+	timeout time.Duration
+	output  io.Writer
+	mu      sync.Mutex
+}
+
+// requestError クライアントに返すステータスを持つエラー
+type requestError struct {
+	status  int
+	message string
+}
+
+// logWriter サーバのログとして出力
+type logWriter struct {
+	server *server
+}
+
+// streamWriter 書き込みごとにレスポンスをフラッシュし、変換した行を順次返す
+type streamWriter struct {
+	writer  http.ResponseWriter
+	written bool
+}
+
+// contextReader コンテキストが終了した後の読み込みをエラーとする
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func runServe(arguments []string, output io.Writer) int {
+
+	var addr string
+	var mappingDir string
+	var maxSize string
+	var timeout time.Duration
+	var help bool
+
+	flagSet := flag.NewFlagSet("xml2csv serve", flag.ContinueOnError)
+
+	flagSet.StringVar(&addr, "addr", ":8080", "(optional) Address to listen on")
+	flagSet.StringVar(&mappingDir, "mappings", "", "(optional) Directory of mapping files to specify by name")
+	flagSet.StringVar(&maxSize, "max-size", "10MB", "(optional) Maximum size of a request body")
+	flagSet.DurationVar(&timeout, "timeout", time.Minute, "(optional) Timeout of a request")
+	flagSet.BoolVarP(&help, "help", "h", false, "Help")
+
+	flagSet.SortFlags = false
+	flagSet.Usage = func() {
+		fmt.Fprintf(output, "xml2csv v%s (%s)\n\n", Version, Commit)
+		fmt.Fprint(output, "Usage: xml2csv serve [flags]\n\nFlags\n")
+		flagSet.PrintDefaults()
+		fmt.Fprintln(output)
+	}
+	flagSet.SetOutput(output)
+
+	if err := flagSet.Parse(arguments); err != nil {
+		flagSet.Usage()
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	maxSizeBytes, err := parseSize(maxSize)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid max size specification:", err)
+		return NG
+	}
+
+	if help {
+		flagSet.Usage()
+		return OK
+	}
+
+	if timeout <= 0 {
+		flagSet.Usage()
+		return NG
+	}
+
+	s, err := newServer(mappingDir, maxSizeBytes, timeout, output)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.listen(ctx, addr); err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	return OK
+}
+
+func newServer(mappingDir string, maxSize int64, timeout time.Duration, output io.Writer) (*server, error) {
+
+	if mappingDir != "" {
+		info, err := os.Stat(mappingDir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", mappingDir)
+		}
+	}
+
+	return &server{
+		mappingDir: mappingDir,
+		maxSize:    maxSize,
+		timeout:    timeout,
+		output:     output,
+	}, nil
+}
+
+// listen serves the API until the context is canceled, and then waits for the requests in progress.
+func (s *server) listen(ctx context.Context, addr string) error {
+
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: s.timeout,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		s.logf("listening on %s", addr)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	return httpServer.Shutdown(shutdownCtx)
+}
+
+func (s *server) handler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("POST /convert", s.handleConvert)
+
+	return mux
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleConvert converts the request body, and streams the rows as the response.
+// The mapping is specified by name in the query, or as the "mapping" part before the "input" part of multipart.
+func (s *server) handleConvert(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	// 対応していないResponseWriterの場合は、コンテキストでのタイムアウトのみ
+	deadline := time.Now().Add(s.timeout)
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(deadline)
+	controller.SetWriteDeadline(deadline)
+
+	// リクエストボディを読みながらレスポンスを返す
+	controller.EnableFullDuplex()
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxSize)
+
+	mapping, input, inputName, err := s.readRequest(r)
+	if err != nil {
+		s.fail(w, false, err)
+		return
+	}
+
+	format, err := requestFormat(r.URL.Query(), mapping)
+	if err != nil {
+		s.fail(w, false, err)
+		return
+	}
+
+	if format.OutputFormat == OutputFormatJSON {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	} else if format.OutputFormat == OutputFormatFixed {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+
+	stream := &streamWriter{writer: w}
+	if err := s.convert(&contextReader{ctx: ctx, reader: input}, inputName, mapping, stream, format); err != nil {
+		s.fail(w, stream.written, err)
+	}
+}
+
+// readRequest returns the mapping and the reader of the input.
+func (s *server) readRequest(r *http.Request) (*Mapping, io.Reader, string, error) {
+
+	var mapping *Mapping
+	if name := r.URL.Query().Get("mapping"); name != "" {
+		var err error
+		if mapping, err = s.loadNamedMapping(name); err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if mapping == nil {
+			return nil, nil, "", &requestError{status: http.StatusBadRequest, message: "mapping is not specified"}
+		}
+		return mapping, r.Body, "input", nil
+	}
+
+	parts, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, "", &requestError{status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			return nil, nil, "", &requestError{status: http.StatusBadRequest, message: "input part is not found"}
+		}
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		switch part.FormName() {
+		case "mapping":
+			if mapping, err = readMappingPart(part); err != nil {
+				return nil, nil, "", err
+			}
+		case "input":
+			// 入力はストリームで読み込むため、マッピングはその前に必要
+			if mapping == nil {
+				return nil, nil, "", &requestError{status: http.StatusBadRequest, message: "mapping is not specified before input part"}
+			}
+
+			inputName := part.FileName()
+			if inputName == "" {
+				inputName = "input"
+			}
+			return mapping, part, inputName, nil
+		}
+	}
+}
+
+func readMappingPart(part *multipart.Part) (*Mapping, error) {
+
+	content, err := io.ReadAll(part)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping, err := parseMapping(part.FileName(), content)
+	if err != nil {
+		return nil, &requestError{status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	return mapping, nil
+}
+
+// loadNamedMapping loads the mapping file in the mapping directory. The extension can be omitted.
+func (s *server) loadNamedMapping(name string) (*Mapping, error) {
+
+	if s.mappingDir == "" {
+		return nil, &requestError{status: http.StatusBadRequest, message: "mapping directory is not configured"}
+	}
+	if !mappingNamePattern.MatchString(name) {
+		return nil, &requestError{status: http.StatusBadRequest, message: fmt.Sprintf("mapping '%s' is invalid name", name)}
+	}
+
+	for _, fileName := range []string{name, name + ".json", name + ".yaml", name + ".yml", name + ".toml"} {
+		path := filepath.Join(s.mappingDir, fileName)
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+
+		// 変更が反映されるよう、リクエストごとに読み込む
+		mapping, err := loadMapping(path)
+		if err != nil {
+			return nil, &requestError{status: http.StatusInternalServerError, message: fmt.Sprintf("mapping '%s' is failed: %v", name, err)}
+		}
+		return mapping, nil
+	}
+
+	return nil, &requestError{status: http.StatusNotFound, message: fmt.Sprintf("mapping '%s' is not found", name)}
+}
+
+// requestFormat gets the output format from the query parameters.
+func requestFormat(query url.Values, mapping *Mapping) (Format, error) {
+
+	format := Format{Delimiter: ',', NullValue: mapping.NullValue}
+
+	var err error
+	if format.OutputFormat, err = parseOutputFormat(query.Get("format")); err != nil {
+		return format, &requestError{status: http.StatusBadRequest, message: err.Error()}
+	}
+	if format.InputFormat, err = parseInputFormat(query.Get("input-format")); err != nil {
+		return format, &requestError{status: http.StatusBadRequest, message: err.Error()}
+	}
+
+	if format.OutputFormat == OutputFormatFixed {
+		if err := validateFixedWidth(mapping); err != nil {
+			return format, &requestError{status: http.StatusBadRequest, message: err.Error()}
+		}
+		format.WithoutHeader = true
+		format.FixedColumns = mapping.Columns
+	}
+
+	if delimiter := query.Get("delimiter"); delimiter != "" {
+		if format.Delimiter, err = getDelimiterRune(delimiter); err != nil {
+			return format, &requestError{status: http.StatusBadRequest, message: "delimiter is invalid: " + err.Error()}
+		}
+	}
+
+	if bom := query.Get("bom"); bom != "" {
+		if format.WithBom, err = strconv.ParseBool(bom); err != nil {
+			return format, &requestError{status: http.StatusBadRequest, message: "bom must be true or false"}
+		}
+	}
+
+	return format, nil
+}
+
+func (s *server) convert(reader io.Reader, inputName string, mapping *Mapping, writer io.Writer, format Format) error {
+
+	baseWriter, err := newRowWriter(writer, mapping.outputHeaders(), format)
+	if err != nil {
+		return err
+	}
+
+	rowWriter, closeWriter := newPipelineRowWriter(baseWriter, mapping, format)
+	defer closeWriter()
+
+	if err := convertReader(reader, inputName, mapping, resolveInputFormat(inputName, format.InputFormat), rowWriter, &logWriter{server: s}); err != nil {
+		return err
+	}
+
+	return rowWriter.Flush()
+}
+
+// fail returns the error as the response. After the response has started, the error is returned as the trailer.
+func (s *server) fail(w http.ResponseWriter, written bool, err error) {
+
+	s.logf("failed: %v", err)
+
+	// トレーラーは1行のみ
+	message := strings.ReplaceAll(err.Error(), "\n", " ")
+	if written {
+		w.Header().Set(errorTrailer, message)
+		return
+	}
+
+	http.Error(w, message, statusOf(err))
+}
+
+func statusOf(err error) int {
+
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	// 一時ファイルの作成や書き込みなど、入力によらないサーバ側の失敗
+	var pathErr *fs.PathError
+	var syscallErr *os.SyscallError
+	if errors.As(err, &pathErr) || errors.As(err, &syscallErr) {
+		return http.StatusInternalServerError
+	}
+
+	// 変換できない入力
+	return http.StatusBadRequest
+}
+
+func (s *server) logf(format string, args ...any) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(s.output, format+"\n", args...)
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+
+	w.server.logf("%s", strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+
+	if !w.written {
+		// エラーを返せるよう、出力を開始する前にトレーラーを宣言
+		w.writer.Header().Set("Trailer", errorTrailer)
+		w.written = true
+	}
+
+	n, err := w.writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if flusher, ok := w.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return n, nil
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const serveMapping = `
+{
+	"rowsPath": "//item",
+	"columns": [
+		{
+			"header": "id",
+			"valuePath": "/id",
+			"required": true
+		},
+		{
+			"header": "name",
+			"valuePath": "/name"
+		}
+	]
+}`
+
+func newTestServer(t *testing.T, maxSize int64, timeout time.Duration) *server {
+
+	temp := t.TempDir()
+	createFile(t, temp, "items.json", serveMapping)
+	createFile(t, temp, "broken.yaml", "rowsPath: [")
+
+	s, err := newServer(temp, maxSize, timeout, new(bytes.Buffer))
+	require.NoError(t, err)
+
+	return s
+}
+
+func TestServer_Health(t *testing.T) {
+
+	// ARRANGE
+	s := newTestServer(t, 1024, time.Minute)
+	request := httptest.NewRequest(http.MethodGet, "/health", nil)
+	response := httptest.NewRecorder()
+
+	// ACT
+	s.handler().ServeHTTP(response, request)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "ok\n", response.Body.String())
+}
+
+func TestServer_Convert(t *testing.T) {
+
+	// ARRANGE
+	s := newTestServer(t, 1024, time.Minute)
+	request := httptest.NewRequest(http.MethodPost, "/convert?mapping=items&delimiter=%3B&bom=true",
+		strings.NewReader(`<root><item><id>1</id><name>a</name></item><item><id>2</id></item></root>`))
+	response := httptest.NewRecorder()
+
+	// ACT
+	s.handler().ServeHTTP(response, request)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Equal(t, joinRows("\uFEFFid;name", "1;a", "2;"), response.Body.String())
+	assert.True(t, response.Flushed)
+}
+
+func TestServer_Convert_JSON(t *testing.T) {
+
+	// ARRANGE
+	s := newTestServer(t, 1024, time.Minute)
+	request := httptest.NewRequest(http.MethodPost, "/convert?mapping=items.json&format=json",
+		strings.NewReader(`<root><item><id>1</id><name>a</name></item><item><id>2</id></item></root>`))
+	response := httptest.NewRecorder()
+
+	// ACT
+	s.handler().ServeHTTP(response, request)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+
+	expect := `[
+  {"id": "1", "name": "a"},
+  {"id": "2", "name": null}
+]
+`
+	assert.Equal(t, expect, response.Body.String())
+}
+
+func TestServer_Convert_Multipart(t *testing.T) {
+
+	// ARRANGE
+	s := newTestServer(t, 1024, time.Minute)
+
+	body := new(bytes.Buffer)
+	parts := multipart.NewWriter(body)
+
+	mappingPart, err := parts.CreateFormFile("mapping", "mapping.yaml")
+	require.NoError(t, err)
+	io.WriteString(mappingPart, "rowsPath: //book/*\ncolumns:\n  - header: title\n    valuePath: /title\n")
+
+	inputPart, err := parts.CreateFormFile("input", "books.json")
+	require.NoError(t, err)
+	io.WriteString(inputPart, `{"book": [{"title": "x"}, {"title": "y"}]}`)
+	require.NoError(t, parts.Close())
+
+	request := httptest.NewRequest(http.MethodPost, "/convert", body)
+	request.Header.Set("Content-Type", parts.FormDataContentType())
+	response := httptest.NewRecorder()
+
+	// ACT
+	s.handler().ServeHTTP(response, request)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, joinRows("title", "x", "y"), response.Body.String())
+}
+
+func TestServer_Convert_Error(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+		expect string
+	}{
+		{
+			name:   "no mapping",
+			target: "/convert",
+			body:   `<root></root>`,
+			status: http.StatusBadRequest,
+			expect: "mapping is not specified\n",
+		},
+		{
+			name:   "not found",
+			target: "/convert?mapping=unknown",
+			body:   `<root></root>`,
+			status: http.StatusNotFound,
+			expect: "mapping 'unknown' is not found\n",
+		},
+		{
+			name:   "invalid name",
+			target: "/convert?mapping=..%2Fitems",
+			body:   `<root></root>`,
+			status: http.StatusBadRequest,
+			expect: "mapping '../items' is invalid name\n",
+		},
+		{
+			name:   "broken mapping",
+			target: "/convert?mapping=broken",
+			body:   `<root></root>`,
+			status: http.StatusInternalServerError,
+			expect: "mapping 'broken' is failed: invalid mapping format: yaml: line 1: did not find expected node content\n",
+		},
+		{
+			name:   "invalid format",
+			target: "/convert?mapping=items&format=xml",
+			body:   `<root></root>`,
+			status: http.StatusBadRequest,
+			expect: "output format must be one of csv, json, fixed\n",
+		},
+		{
+			name:   "invalid row",
+			target: "/convert?mapping=items",
+			body:   `<root><item><name>a</name></item></root>`,
+			status: http.StatusBadRequest,
+			expect: "input is failed: row 1: column 'id' is required\n",
+		},
+		{
+			name:   "too large",
+			target: "/convert?mapping=items",
+			body:   `<root>` + strings.Repeat(`<item><id>1</id></item>`, 100) + `</root>`,
+			status: http.StatusRequestEntityTooLarge,
+			expect: "input is failed: http: request body too large\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			s := newTestServer(t, 1024, time.Minute)
+			request := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			response := httptest.NewRecorder()
+
+			// ACT
+			s.handler().ServeHTTP(response, request)
+
+			// ASSERT
+			assert.Equal(t, tt.status, response.Code)
+			assert.Equal(t, tt.expect, response.Body.String())
+		})
+	}
+}
+
+func TestServer_Convert_InternalError(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	createFile(t, temp, "last.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{"header": "id", "valuePath": "/id"}
+		],
+		"distinct": {"keep": "last"}
+	}`)
+
+	s, err := newServer(temp, 1024, time.Minute, new(bytes.Buffer))
+	require.NoError(t, err)
+
+	// 一時ファイルを作成できない
+	t.Setenv("TMPDIR", filepath.Join(temp, "missing"))
+
+	request := httptest.NewRequest(http.MethodPost, "/convert?mapping=last", strings.NewReader(`<root><item><id>1</id></item></root>`))
+	response := httptest.NewRecorder()
+
+	// ACT
+	s.handler().ServeHTTP(response, request)
+
+	// ASSERT
+	assert.Equal(t, http.StatusInternalServerError, response.Code)
+}
+
+func TestServer_Convert_Timeout(t *testing.T) {
+
+	// ARRANGE
+	s := newTestServer(t, 1024, 10*time.Millisecond)
+	request := httptest.NewRequest(http.MethodPost, "/convert?mapping=items",
+		&slowReader{reader: strings.NewReader(`<root><item><id>1</id></item></root>`), delay: 20 * time.Millisecond})
+	response := httptest.NewRecorder()
+
+	// ACT
+	s.handler().ServeHTTP(response, request)
+
+	// ASSERT
+	assert.Equal(t, http.StatusGatewayTimeout, response.Code)
+	assert.Equal(t, "input is failed: context deadline exceeded\n", response.Body.String())
+}
+
+func TestServer_Convert_ErrorAfterStreaming(t *testing.T) {
+
+	// ARRANGE
+	s := newTestServer(t, 1024*1024, time.Minute)
+	httpServer := httptest.NewServer(s.handler())
+	defer httpServer.Close()
+
+	// バッファを超える行を出力した後にエラー
+	input := `<root>` + strings.Repeat(`<item><id>1</id></item>`, 10000) + `<item></item></root>`
+
+	// ACT
+	response, err := http.Post(httpServer.URL+"/convert?mapping=items", "application/xml", strings.NewReader(input))
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	// ASSERT
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []string{"chunked"}, response.TransferEncoding)
+	assert.True(t, strings.HasPrefix(string(body), joinRows("id,name", "1,", "1,")))
+	assert.Equal(t, "input is failed: row 10001: column 'id' is required", response.Trailer.Get(errorTrailer))
+}
+
+func TestRunServe_InvalidMaxSize(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run([]string{"serve", "--max-size", "0"}, out)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "Invalid max size specification: size must be greater than 0\n", out.String())
+}
+
+// slowReader 読み込みごとに待機する
+type slowReader struct {
+	reader io.Reader
+	delay  time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.reader.Read(p)
+}
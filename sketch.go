@@ -0,0 +1,174 @@
+package main
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// hyperLogLogPrecision レジスタ数(2^precision)を決める精度(誤差は約0.8%)
+const hyperLogLogPrecision = 14
+
+// hyperLogLog 一定のメモリで異なる値の数を推定
+type hyperLogLog struct {
+	registers []uint8
+}
+
+// topK 一定のメモリで出現回数の多い値を推定(Space-Saving)
+type topK struct {
+	capacity int
+	counters map[string]*topKCounter
+	// heap 回数の少ない順のヒープ(置き換える値をO(log k)で求める)
+	heap topKHeap
+}
+
+// topKCounter 値の出現回数とヒープ上の位置
+type topKCounter struct {
+	value string
+	count int64
+	index int
+}
+
+type topKHeap []*topKCounter
+
+type valueCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hyperLogLogPrecision)}
+}
+
+func (h *hyperLogLog) add(value string) {
+
+	hash := hashString(value)
+
+	index := hash >> (64 - hyperLogLogPrecision)
+	// 先頭の0の数(残りのビットが全て0でも上限を超えないよう番兵のビットを立てる)
+	rank := uint8(bits.LeadingZeros64(hash<<hyperLogLogPrecision|1<<(hyperLogLogPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) count() uint64 {
+
+	m := float64(len(h.registers))
+
+	sum := 0.0
+	zeros := 0
+	for _, register := range h.registers {
+		sum += 1 / float64(uint64(1)<<register)
+		if register == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+
+	// 少ない場合は線形カウンティングで補正
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
+
+func newTopK(k int) *topK {
+
+	// 誤差を減らすため、出力する数より多くの値を保持
+	return &topK{capacity: max(k*10, 100), counters: map[string]*topKCounter{}}
+}
+
+func (t *topK) add(value string) {
+
+	if counter, found := t.counters[value]; found {
+		counter.count++
+		heap.Fix(&t.heap, counter.index)
+		return
+	}
+
+	if len(t.counters) < t.capacity {
+		counter := &topKCounter{value: value, count: 1}
+		t.counters[value] = counter
+		heap.Push(&t.heap, counter)
+		return
+	}
+
+	// 最も少ない値を置き換え(置き換えた値の回数は上限として引き継ぐ)
+	minimum := t.heap[0]
+	delete(t.counters, minimum.value)
+
+	minimum.value = value
+	minimum.count++
+	t.counters[value] = minimum
+	heap.Fix(&t.heap, minimum.index)
+}
+
+// top returns the k most frequent values in descending order of the count.
+func (t *topK) top(k int) []valueCount {
+
+	counts := make([]valueCount, 0, len(t.counters))
+	for _, counter := range t.counters {
+		counts = append(counts, valueCount{Value: counter.value, Count: counter.count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+
+	if len(counts) > k {
+		counts = counts[:k]
+	}
+
+	return counts
+}
+
+func (h topKHeap) Len() int { return len(h) }
+
+func (h topKHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h topKHeap) Swap(i, j int) {
+
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x any) {
+
+	counter := x.(*topKCounter)
+	counter.index = len(*h)
+	*h = append(*h, counter)
+}
+
+func (h *topKHeap) Pop() any {
+
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// hashString hashes the value with FNV-1a, and mixes the bits so that they are evenly distributed.
+func hashString(value string) uint64 {
+
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	h := hash.Sum64()
+
+	// splitmix64の最終処理
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+
+	return h
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// sortMemoryBytes メモリ上で並び替える行の概算のバイト数(超えた分は並び替えて一時ファイルに退避し、最後にマージ)
+var sortMemoryBytes = 64 << 20
+
+// sortMergeFanIn 一度にマージする退避ファイルの数(同時に開くファイルの数を抑える)
+var sortMergeFanIn = 64
+
+// SortKey 並び替えのキー
+type SortKey struct {
+	Header     string
+	Descending bool
+	Numeric    bool
+}
+
+// sortRowWriter 全ての行を並び替えてから出力
+type sortRowWriter struct {
+	writer  rowWriter
+	keys    []SortKey
+	indexes []int
+	rows    [][]*string
+	// size メモリ上の行の概算のバイト数
+	size int
+	// runs 退避した順の並び替え済みのファイル
+	runs []*sortedRun
+}
+
+// sortedRun 並び替え済みの退避ファイル
+type sortedRun struct {
+	spool *rowSpool
+	// level マージした回数(同じ階層の退避ファイルがsortMergeFanIn個そろったらマージ)
+	level int
+}
+
+// sortRun マージ中の退避ファイルの先頭行
+type sortRun struct {
+	reader *rowSpoolReader
+	values []*string
+	order  int
+}
+
+type sortRunHeap struct {
+	runs []*sortRun
+	less func(a, b []*string) int
+}
+
+// parseSortKeys parses the sort specifications in the form of 'header[:desc][:numeric]'.
+func parseSortKeys(specs []string) ([]SortKey, error) {
+
+	var keys []SortKey
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		key := SortKey{Header: parts[0]}
+		if key.Header == "" {
+			return nil, fmt.Errorf("header is empty in '%s'", spec)
+		}
+
+		for _, option := range parts[1:] {
+			switch strings.ToLower(option) {
+			case "asc":
+				key.Descending = false
+			case "desc":
+				key.Descending = true
+			case "numeric":
+				key.Numeric = true
+			default:
+				return nil, fmt.Errorf("unknown option '%s' in '%s' (must be asc, desc or numeric)", option, spec)
+			}
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// validateSortKeys checks that the headers of the keys are headers of the output.
+func validateSortKeys(keys []SortKey, headers []string) error {
+
+	for _, key := range keys {
+		if !slices.Contains(headers, key.Header) {
+			return fmt.Errorf("sort key '%s' is not a header of the output", key.Header)
+		}
+	}
+
+	return nil
+}
+
+func newSortRowWriter(writer rowWriter, headers []string, keys []SortKey) *sortRowWriter {
+
+	var indexes []int
+	for _, key := range keys {
+		indexes = append(indexes, slices.Index(headers, key.Header))
+	}
+
+	return &sortRowWriter{writer: writer, keys: keys, indexes: indexes}
+}
+
+func (w *sortRowWriter) Write(values []*string) error {
+
+	w.rows = append(w.rows, values)
+	w.size += rowSize(values)
+	if w.size >= sortMemoryBytes {
+		return w.spill()
+	}
+
+	return nil
+}
+
+func (w *sortRowWriter) Flush() error {
+
+	if len(w.runs) == 0 {
+		// 全てメモリ上にある場合はそのまま並び替えて出力
+		slices.SortStableFunc(w.rows, w.compare)
+		for _, values := range w.rows {
+			if err := w.writer.Write(values); err != nil {
+				return err
+			}
+		}
+		w.rows = nil
+
+		return w.writer.Flush()
+	}
+
+	if len(w.rows) > 0 {
+		if err := w.spill(); err != nil {
+			return err
+		}
+	}
+
+	// 一度にマージする数に収まるまで、隣り合う退避ファイルをまとめる
+	for len(w.runs) > sortMergeFanIn {
+		var merged []*sortedRun
+		for start := 0; start < len(w.runs); start += sortMergeFanIn {
+			group := w.runs[start:min(start+sortMergeFanIn, len(w.runs))]
+			run, err := w.mergeRuns(group)
+			if err != nil {
+				// 残りの退避ファイルと合わせてcloseで削除
+				w.runs = append(merged, w.runs[start:]...)
+				return err
+			}
+			merged = append(merged, run)
+		}
+		w.runs = merged
+	}
+
+	if err := w.merge(w.runs, w.writer.Write); err != nil {
+		return err
+	}
+
+	return w.writer.Flush()
+}
+
+// close removes the temporary files.
+func (w *sortRowWriter) close() {
+
+	for _, run := range w.runs {
+		run.spool.remove()
+	}
+	w.runs = nil
+}
+
+// spill sorts the rows in memory and writes them to a temporary file.
+// When sortMergeFanIn files of the same level are written, they are merged into one file of the next level,
+// so the number of the open files stays small.
+func (w *sortRowWriter) spill() error {
+
+	slices.SortStableFunc(w.rows, w.compare)
+
+	spool, err := newRowSpool()
+	if err != nil {
+		return err
+	}
+	w.runs = append(w.runs, &sortedRun{spool: spool})
+
+	for _, values := range w.rows {
+		if err := spool.write(values); err != nil {
+			return err
+		}
+	}
+	w.rows = w.rows[:0]
+	w.size = 0
+
+	// 階層は退避した順に高い方から並ぶため、末尾がそろっていればマージ
+	for len(w.runs) >= sortMergeFanIn {
+		group := w.runs[len(w.runs)-sortMergeFanIn:]
+		if group[0].level != group[len(group)-1].level {
+			break
+		}
+
+		run, err := w.mergeRuns(group)
+		if err != nil {
+			return err
+		}
+		w.runs = append(w.runs[:len(w.runs)-sortMergeFanIn], run)
+	}
+
+	return nil
+}
+
+// mergeRuns merges the adjacent sorted files into a new file, and removes the merged files.
+func (w *sortRowWriter) mergeRuns(group []*sortedRun) (*sortedRun, error) {
+
+	spool, err := newRowSpool()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.merge(group, spool.write); err != nil {
+		spool.remove()
+		return nil, err
+	}
+
+	level := 0
+	for _, run := range group {
+		level = max(level, run.level)
+		run.spool.remove()
+	}
+
+	return &sortedRun{spool: spool, level: level + 1}, nil
+}
+
+// merge merges the sorted files and writes the rows in order.
+func (w *sortRowWriter) merge(group []*sortedRun, write func(values []*string) error) error {
+
+	runs := &sortRunHeap{less: w.compare}
+	for i, sorted := range group {
+		reader, err := sorted.spool.newReader()
+		if err != nil {
+			return err
+		}
+
+		run := &sortRun{reader: reader, order: i}
+		if found, err := run.next(); err != nil {
+			return err
+		} else if found {
+			runs.runs = append(runs.runs, run)
+		}
+	}
+	heap.Init(runs)
+
+	for runs.Len() > 0 {
+		run := runs.runs[0]
+		if err := write(run.values); err != nil {
+			return err
+		}
+
+		found, err := run.next()
+		if err != nil {
+			return err
+		}
+		if found {
+			heap.Fix(runs, 0)
+		} else {
+			heap.Pop(runs)
+		}
+	}
+
+	return nil
+}
+
+func (w *sortRowWriter) compare(a, b []*string) int {
+
+	for i, key := range w.keys {
+		result := compareValue(a[w.indexes[i]], b[w.indexes[i]], key.Numeric)
+		if key.Descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+
+	return 0
+}
+
+// rowSize estimates the bytes of the row in memory.
+func rowSize(values []*string) int {
+
+	// スライスとポインタ、文字列のヘッダを含める
+	size := 24 + 8*len(values)
+	for _, value := range values {
+		if value != nil {
+			size += 16 + len(*value)
+		}
+	}
+
+	return size
+}
+
+// compareValue compares the values. A missing value comes first, and in numeric order values which are not numbers (including NaN) come before numbers.
+func compareValue(a *string, b *string, numeric bool) int {
+
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if numeric {
+		aNumber, aOK := parseSortNumber(*a)
+		bNumber, bOK := parseSortNumber(*b)
+		switch {
+		case aOK && bOK:
+			if aNumber < bNumber {
+				return -1
+			}
+			if aNumber > bNumber {
+				return 1
+			}
+			return 0
+		case aOK:
+			return 1
+		case bOK:
+			return -1
+		}
+	}
+
+	return strings.Compare(*a, *b)
+}
+
+// parseSortNumber parses the value as a number. NaN is not a number because it cannot be ordered.
+func parseSortNumber(value string) (float64, bool) {
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(number) {
+		return 0, false
+	}
+
+	return number, true
+}
+
+// next reads the next row of the run, and returns false at the end.
+func (r *sortRun) next() (bool, error) {
+
+	values, err := r.reader.next()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	r.values = values
+	return true, nil
+}
+
+func (h *sortRunHeap) Len() int { return len(h.runs) }
+
+func (h *sortRunHeap) Less(i, j int) bool {
+
+	// 同じ値の場合は先に退避した行を優先し、安定した並び替えとする
+	if result := h.less(h.runs[i].values, h.runs[j].values); result != 0 {
+		return result < 0
+	}
+	return h.runs[i].order < h.runs[j].order
+}
+
+func (h *sortRunHeap) Swap(i, j int) { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+
+func (h *sortRunHeap) Push(x any) { h.runs = append(h.runs, x.(*sortRun)) }
+
+func (h *sortRunHeap) Pop() any {
+
+	last := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return last
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordRowWriter 書き込まれた行をカンマ区切りで記録
+type recordRowWriter struct {
+	rows []string
+}
+
+func (w *recordRowWriter) Write(values []*string) error {
+
+	var fields []string
+	for _, value := range values {
+		fields = append(fields, *value)
+	}
+	w.rows = append(w.rows, strings.Join(fields, ","))
+
+	return nil
+}
+
+func (w *recordRowWriter) Flush() error {
+	return nil
+}
+
+func TestRun_SortBy(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><group>b</group><amount>9</amount></item>
+	<item><group>a</group><amount>10</amount></item>
+	<item><group>b</group><amount>100</amount></item>
+	<item><group>a</group><amount>x</amount></item>
+	<item><group>a</group><amount>2</amount></item>
+	<item><amount>1</amount></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "group=/group",
+			"-c", "amount=/amount",
+			"-o", outputPath,
+			"--sort-by", "group",
+			"--sort-by", "amount:desc:numeric",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"group,amount",
+		",1",
+		"a,10",
+		"a,2",
+		"a,x",
+		"b,100",
+		"b,9",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_SortBy_Spill(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	// 1行ずつ退避し、2つずつマージ
+	originalBytes, originalFanIn := sortMemoryBytes, sortMergeFanIn
+	sortMemoryBytes, sortMergeFanIn = 1, 2
+	t.Cleanup(func() { sortMemoryBytes, sortMergeFanIn = originalBytes, originalFanIn })
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>1</id><key>c</key></item>
+	<item><id>2</id><key>a</key></item>
+	<item><id>3</id><key>b</key></item>
+	<item><id>4</id><key>a</key></item>
+	<item><id>5</id><key>c</key></item>
+	<item><id>6</id><key>b</key></item>
+	<item><id>7</id><key>a</key></item>
+	</root>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-c", "key=/key",
+			"-o", outputPath,
+			"--sort-by", "key",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// 同じ値の行は入力の順序のまま
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id,key",
+		"2,a",
+		"4,a",
+		"7,a",
+		"3,b",
+		"6,b",
+		"1,c",
+		"5,c",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestSortRowWriter_FanIn(t *testing.T) {
+
+	// ARRANGE
+	originalBytes, originalFanIn := sortMemoryBytes, sortMergeFanIn
+	sortMemoryBytes, sortMergeFanIn = 1, 3
+	t.Cleanup(func() { sortMemoryBytes, sortMergeFanIn = originalBytes, originalFanIn })
+
+	output := &recordRowWriter{}
+	writer := newSortRowWriter(output, []string{"key", "id"}, []SortKey{{Header: "key", Numeric: true}})
+	defer writer.close()
+
+	var expect []string
+	for i := 0; i < 50; i++ {
+		key := strconv.Itoa(i % 7)
+		id := strconv.Itoa(i)
+		require.NoError(t, writer.Write([]*string{&key, &id}))
+
+		// 同時に開く退避ファイルは階層ごとにsortMergeFanIn未満
+		assert.LessOrEqual(t, len(writer.runs), 2*4)
+	}
+	for key := 0; key < 7; key++ {
+		for i := key; i < 50; i += 7 {
+			expect = append(expect, fmt.Sprintf("%d,%d", key, i))
+		}
+	}
+
+	// ACT
+	err := writer.Flush()
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, expect, output.rows)
+}
+
+func TestRun_SortBy_Invalid(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		sortBy string
+		expect string
+	}{
+		{
+			name:   "option",
+			sortBy: "title:up",
+			expect: "Invalid sort specification: unknown option 'up' in 'title:up' (must be asc, desc or numeric)\n",
+		},
+		{
+			name:   "header",
+			sortBy: "name",
+			expect: "Invalid sort specification: sort key 'name' is not a header of the output\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			out := new(bytes.Buffer)
+
+			// ACT
+			exitCode := run(
+				[]string{
+					"-i", "testdata/rss.xml",
+					"-m", "mapping/rss.json",
+					"-o", filepath.Join(temp, "output.csv"),
+					"--sort-by", tt.sortBy,
+				},
+				out,
+			)
+
+			// ASSERT
+			require.Equal(t, NG, exitCode)
+			assert.Equal(t, tt.expect, out.String())
+		})
+	}
+}
+
+func TestParseSortKeys(t *testing.T) {
+
+	// ACT
+	result, err := parseSortKeys([]string{"a", "b:desc", "c:numeric", "d:DESC:numeric", "e:desc:asc"})
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := []SortKey{
+		{Header: "a"},
+		{Header: "b", Descending: true},
+		{Header: "c", Numeric: true},
+		{Header: "d", Descending: true, Numeric: true},
+		{Header: "e"},
+	}
+	assert.Equal(t, expect, result)
+}
+
+func TestParseSortKeys_EmptyHeader(t *testing.T) {
+
+	_, err := parseSortKeys([]string{":desc"})
+	assert.EqualError(t, err, "header is empty in ':desc'")
+}
+
+func TestCompareValue(t *testing.T) {
+
+	value := func(s string) *string { return &s }
+
+	assert.Equal(t, -1, compareValue(value("10"), value("9"), false))
+	assert.Equal(t, 1, compareValue(value("10"), value("9"), true))
+	assert.Equal(t, 0, compareValue(value("1.0"), value(" 1 "), true))
+	assert.Equal(t, -1, compareValue(value("x"), value("-5"), true))
+	assert.Equal(t, -1, compareValue(nil, value(""), false))
+	assert.Equal(t, 1, compareValue(value(""), nil, true))
+	assert.Equal(t, 0, compareValue(nil, nil, false))
+
+	// NaNは数値以外として扱う
+	assert.Equal(t, -1, compareValue(value("NaN"), value("1"), true))
+	assert.Equal(t, 1, compareValue(value("-Inf"), value("NaN"), true))
+	assert.Equal(t, -1, compareValue(value("NaN"), value("x"), true))
+}
+
+func TestRowSpool(t *testing.T) {
+
+	// ARRANGE
+	spool, err := newRowSpool()
+	require.NoError(t, err)
+	defer spool.remove()
+
+	a := "a"
+	b := "b"
+	rows := [][]*string{{&a, nil}, {}, {&b, &a}}
+	for _, values := range rows {
+		require.NoError(t, spool.write(values))
+	}
+
+	// ACT
+	var forward [][]*string
+	reader, err := spool.newReader()
+	require.NoError(t, err)
+	for {
+		values, err := reader.next()
+		if err != nil {
+			break
+		}
+		forward = append(forward, values)
+	}
+
+	var reverse [][]*string
+	err = spool.readReverse(func(values []*string) error {
+		reverse = append(reverse, values)
+		return nil
+	})
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, rows, forward)
+	assert.Equal(t, [][]*string{rows[2], rows[1], rows[0]}, reverse)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// rowSpool 行を一時ファイルに退避し、後から読み出す(行の前後に長さを書き込み、前後どちらからも読めるようにする)
+type rowSpool struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// rowSpoolReader 退避した行を先頭から読み込む
+type rowSpoolReader struct {
+	reader *bufio.Reader
+}
+
+// encodeRow encodes the values to bytes, distinguishing nil from an empty string.
+func encodeRow(values []*string) []byte {
+
+	encoded := binary.AppendUvarint(nil, uint64(len(values)))
+	for _, value := range values {
+		if value == nil {
+			encoded = append(encoded, 0)
+			continue
+		}
+
+		encoded = append(encoded, 1)
+		encoded = binary.AppendUvarint(encoded, uint64(len(*value)))
+		encoded = append(encoded, *value...)
+	}
+
+	return encoded
+}
+
+// decodeRow decodes the bytes encoded by encodeRow.
+func decodeRow(encoded []byte) ([]*string, error) {
+
+	count, n := binary.Uvarint(encoded)
+	if n <= 0 {
+		return nil, fmt.Errorf("spooled row is broken")
+	}
+	encoded = encoded[n:]
+
+	values := make([]*string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		if len(encoded) == 0 {
+			return nil, fmt.Errorf("spooled row is broken")
+		}
+
+		present := encoded[0]
+		encoded = encoded[1:]
+		if present == 0 {
+			values = append(values, nil)
+			continue
+		}
+
+		length, n := binary.Uvarint(encoded)
+		if n <= 0 || uint64(len(encoded)-n) < length {
+			return nil, fmt.Errorf("spooled row is broken")
+		}
+
+		value := string(encoded[n : n+int(length)])
+		values = append(values, &value)
+		encoded = encoded[n+int(length):]
+	}
+
+	return values, nil
+}
+
+func newRowSpool() (*rowSpool, error) {
+
+	file, err := os.CreateTemp("", "xml2csv-spool-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &rowSpool{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// write appends the row.
+func (s *rowSpool) write(values []*string) error {
+
+	encoded := encodeRow(values)
+	if err := binary.Write(s.writer, binary.BigEndian, uint64(len(encoded))); err != nil {
+		return err
+	}
+
+	if _, err := s.writer.Write(encoded); err != nil {
+		return err
+	}
+
+	return binary.Write(s.writer, binary.BigEndian, uint64(len(encoded)))
+}
+
+// newReader returns the reader which reads the rows from the first one.
+func (s *rowSpool) newReader() (*rowSpoolReader, error) {
+
+	if err := s.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	size, err := s.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rowSpoolReader{reader: bufio.NewReader(io.NewSectionReader(s.file, 0, size))}, nil
+}
+
+// readReverse reads the rows from the last one.
+func (s *rowSpool) readReverse(read func(values []*string) error) error {
+
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+
+	position, err := s.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	lengthBuffer := make([]byte, 8)
+	for position > 0 {
+		if _, err := s.file.ReadAt(lengthBuffer, position-8); err != nil {
+			return err
+		}
+		length := int64(binary.BigEndian.Uint64(lengthBuffer))
+		position -= 8 + length + 8
+
+		encoded := make([]byte, length)
+		if _, err := s.file.ReadAt(encoded, position+8); err != nil {
+			return err
+		}
+
+		values, err := decodeRow(encoded)
+		if err != nil {
+			return err
+		}
+
+		if err := read(values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove closes and removes the temporary file.
+func (s *rowSpool) remove() {
+
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// next returns the next row, or io.EOF if there are no more rows.
+func (r *rowSpoolReader) next() ([]*string, error) {
+
+	var length uint64
+	if err := binary.Read(r.reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	// 末尾の長さも合わせて読み込む
+	encoded := make([]byte, length+8)
+	if _, err := io.ReadFull(r.reader, encoded); err != nil {
+		return nil, err
+	}
+
+	return decodeRow(encoded[:length])
+}
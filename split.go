@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	splitNumberPlaceholder = "{n}"
+	splitValuePlaceholder  = "{value}"
+)
+
+// maxOpenSplitFiles 同時に開くファイルの最大数(超えた場合は最も長く使われていないファイルを閉じ、次の行で追記として開き直す)
+var maxOpenSplitFiles = 128
+
+var (
+	sizePattern            = regexp.MustCompile(`^(?i)\s*(\d+)\s*([KMG]?)B?\s*$`)
+	invalidFileNamePattern = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+)
+
+// Split 出力ファイルの分割
+type Split struct {
+	// Rows 1ファイルの最大行数
+	Rows int
+	// Bytes 1ファイルの最大バイト数
+	Bytes int64
+	// By 値ごとにファイルを分けるカラムのヘッダ
+	By string
+}
+
+// splitRowWriter 行数、バイト数、カラムの値でファイルを分けて出力
+type splitRowWriter struct {
+	template   string
+	headers    []string
+	format     Format
+	split      Split
+	index      int
+	sizer      *rowSizer
+	headerSize int64
+	trailer    int64
+	current    map[string]*splitPart
+	parts      []*splitPart
+	// names 値ごとのファイル名(置き換えた結果が重複する場合は連番を付与)
+	names map[string]string
+	// usedNames 使用済みのファイル名
+	usedNames map[string]bool
+	// open 開いているファイルの出力先
+	open []*splitPart
+	// clock 最後に使われた順序を判定するためのカウンタ
+	clock int64
+}
+
+type splitPart struct {
+	number int
+	path   string
+	// file 上限により一時的に閉じている場合はnil
+	file   *os.File
+	writer rowWriter
+	rows   int
+	bytes  int64
+	used   int64
+	closed bool
+}
+
+// rowSizer 行を出力した場合のバイト数を求める
+type rowSizer struct {
+	buffer *bytes.Buffer
+	writer rowWriter
+	flush  func() error
+}
+
+func (s Split) enabled() bool {
+	return s.Rows > 0 || s.Bytes > 0 || s.By != ""
+}
+
+// parseSize parses the size such as '100MB', '1G' and '500k' (1KB is 1024 bytes).
+func parseSize(value string) (int64, error) {
+
+	matches := sizePattern.FindStringSubmatch(value)
+	if matches == nil {
+		return 0, fmt.Errorf("size must be a number with an optional unit (KB, MB, GB)")
+	}
+
+	size, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	switch strings.ToUpper(matches[2]) {
+	case "K":
+		size *= 1 << 10
+	case "M":
+		size *= 1 << 20
+	case "G":
+		size *= 1 << 30
+	}
+
+	if size <= 0 {
+		return 0, fmt.Errorf("size must be greater than 0")
+	}
+
+	return size, nil
+}
+
+// splitTemplate returns the template of the file names.
+// If the path has no placeholders, '-{value}' and '-{n}' are appended to the file name (e.g. output-1.csv).
+func splitTemplate(path string, split Split) string {
+
+	if strings.Contains(path, splitNumberPlaceholder) || strings.Contains(path, splitValuePlaceholder) {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	template := strings.TrimSuffix(path, ext)
+	if split.By != "" {
+		template += "-" + splitValuePlaceholder
+	}
+	if split.Rows > 0 || split.Bytes > 0 {
+		template += "-" + splitNumberPlaceholder
+	}
+
+	return template + ext
+}
+
+func newSplitRowWriter(path string, headers []string, format Format, split Split) (*splitRowWriter, error) {
+
+	w := &splitRowWriter{
+		template:  splitTemplate(path, split),
+		headers:   headers,
+		format:    format,
+		split:     split,
+		index:     slices.Index(headers, split.By),
+		current:   map[string]*splitPart{},
+		names:     map[string]string{},
+		usedNames: map[string]bool{},
+	}
+
+	if split.Bytes > 0 {
+		outputHeaders := formatHeaders(headers, format)
+		sizer, err := newRowSizer(outputHeaders, format)
+		if err != nil {
+			return nil, err
+		}
+		w.sizer = sizer
+
+		if format.OutputFormat == OutputFormatJSON {
+			w.headerSize = int64(len("["))
+			w.trailer = int64(len("\n]\n"))
+		} else {
+			// ヘッダと説明の行
+			var headerRows [][]string
+			if !format.WithoutHeader {
+				headerRows = append(headerRows, outputHeaders)
+				if format.Descriptions != nil {
+					headerRows = append(headerRows, format.Descriptions)
+				}
+			}
+
+			for _, headerRow := range headerRows {
+				var headerValues []*string
+				for i := range headerRow {
+					headerValues = append(headerValues, &headerRow[i])
+				}
+
+				size, err := sizer.size(headerValues)
+				if err != nil {
+					return nil, err
+				}
+				w.headerSize += size
+			}
+			if format.WithBom {
+				w.headerSize += 3
+			}
+		}
+	}
+
+	return w, nil
+}
+
+func (w *splitRowWriter) Write(values []*string) error {
+
+	value := ""
+	if w.index != -1 && values[w.index] != nil {
+		value = *values[w.index]
+	}
+
+	var size int64
+	if w.sizer != nil {
+		var err error
+		if size, err = w.sizer.size(values); err != nil {
+			return err
+		}
+	}
+
+	part := w.current[value]
+	if part == nil ||
+		(w.split.Rows > 0 && part.rows >= w.split.Rows) ||
+		(w.split.Bytes > 0 && part.rows > 0 && part.bytes+size+w.trailer > w.split.Bytes) {
+
+		number := 1
+		if part != nil {
+			// 上限に達したファイルは閉じて次のファイルへ
+			if err := w.closePart(part); err != nil {
+				return err
+			}
+			number = part.number + 1
+		}
+
+		var err error
+		if part, err = w.create(value, number); err != nil {
+			return err
+		}
+	} else if part.file == nil {
+		if err := w.reopen(part); err != nil {
+			return err
+		}
+	}
+
+	w.clock++
+	part.used = w.clock
+
+	if err := part.writer.Write(values); err != nil {
+		return err
+	}
+	part.rows++
+	part.bytes += size
+
+	return nil
+}
+
+func (w *splitRowWriter) Flush() error {
+
+	// 行が無い場合もヘッダのみのファイルを出力(値で分ける場合は出力しない)
+	if len(w.parts) == 0 && w.split.By == "" {
+		if _, err := w.create("", 1); err != nil {
+			return err
+		}
+	}
+
+	for _, part := range w.parts {
+		if err := w.closePart(part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close closes the files which are not closed due to an error.
+func (w *splitRowWriter) close() {
+
+	for _, part := range w.parts {
+		if !part.closed && part.file != nil {
+			part.file.Close()
+		}
+	}
+}
+
+// create creates the file of the value and the number, and writes the header.
+func (w *splitRowWriter) create(value string, number int) (*splitPart, error) {
+
+	path := strings.ReplaceAll(w.template, splitNumberPlaceholder, strconv.Itoa(number))
+	path = strings.ReplaceAll(path, splitValuePlaceholder, w.nameOf(value))
+
+	if err := w.reserve(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	part := &splitPart{number: number, path: path, file: file, bytes: w.headerSize}
+	w.parts = append(w.parts, part)
+	w.open = append(w.open, part)
+	w.current[value] = part
+
+	if part.writer, err = newRowWriter(file, w.headers, w.format); err != nil {
+		return nil, err
+	}
+
+	return part, nil
+}
+
+// reserve suspends the least recently used part if the number of the open files reaches the limit.
+func (w *splitRowWriter) reserve() error {
+
+	if len(w.open) < maxOpenSplitFiles {
+		return nil
+	}
+
+	oldest := 0
+	for i, part := range w.open {
+		if part.used < w.open[oldest].used {
+			oldest = i
+		}
+	}
+
+	part := w.open[oldest]
+	w.open = slices.Delete(w.open, oldest, oldest+1)
+
+	return part.suspend()
+}
+
+// reopen opens the file of the suspended part to append the following rows.
+func (w *splitRowWriter) reopen(part *splitPart) error {
+
+	if err := w.reserve(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(part.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	part.file = file
+	w.open = append(w.open, part)
+
+	if w.format.OutputFormat == OutputFormatJSON {
+		// 配列の開始は出力済みのため、続きの要素として出力
+		part.writer = &jsonRowWriter{writer: bufio.NewWriter(file), headers: formatHeaders(w.headers, w.format), rows: part.rows}
+		return nil
+	}
+
+	// BOMとヘッダは出力済み
+	format := w.format
+	format.WithBom = false
+	format.WithoutHeader = true
+	format.Descriptions = nil
+
+	part.writer, err = newRowWriter(file, w.headers, format)
+	return err
+}
+
+// closePart finishes the output of the part.
+func (w *splitRowWriter) closePart(part *splitPart) error {
+
+	if !part.closed && part.file == nil && w.format.OutputFormat == OutputFormatJSON {
+		// 配列の終わりを出力するため開き直す
+		if err := w.reopen(part); err != nil {
+			return err
+		}
+	}
+
+	if index := slices.Index(w.open, part); index != -1 {
+		w.open = slices.Delete(w.open, index, index+1)
+	}
+
+	return part.close()
+}
+
+// suspend writes out the buffered rows and closes the file without finishing the output.
+func (p *splitPart) suspend() error {
+
+	flush := p.writer.Flush
+	if jsonWriter, ok := p.writer.(*jsonRowWriter); ok {
+		// 配列は閉じずにバッファのみ書き出す
+		flush = jsonWriter.writer.Flush
+	}
+
+	err := flush()
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+	p.file = nil
+	p.writer = nil
+
+	return err
+}
+
+func (p *splitPart) close() error {
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	if p.file == nil {
+		// 一時的に閉じた時点で書き出し済み
+		return nil
+	}
+
+	if err := p.writer.Flush(); err != nil {
+		p.file.Close()
+		return err
+	}
+
+	return p.file.Close()
+}
+
+// nameOf returns the file name of the value.
+// If the name is already used by another value (e.g. 'a/b' and 'a_b'), a number is appended such as 'a_b_2'.
+func (w *splitRowWriter) nameOf(value string) string {
+
+	if name, found := w.names[value]; found {
+		return name
+	}
+
+	base := fileNameOf(value)
+	name := base
+	for n := 2; w.usedNames[name]; n++ {
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+
+	w.names[value] = name
+	w.usedNames[name] = true
+
+	return name
+}
+
+// validateSplitTemplate checks that the file name makes the files distinct for the split.
+// A name without placeholders is valid since they are appended.
+func validateSplitTemplate(path string, split Split) error {
+
+	template := splitTemplate(path, split)
+	if (split.Rows > 0 || split.Bytes > 0) && !strings.Contains(template, splitNumberPlaceholder) {
+		return fmt.Errorf("output file name must contain '%s' to split by rows or size", splitNumberPlaceholder)
+	}
+	if split.By != "" && !strings.Contains(template, splitValuePlaceholder) {
+		return fmt.Errorf("output file name must contain '%s' to split by value", splitValuePlaceholder)
+	}
+
+	return nil
+}
+
+// fileNameOf replaces the characters which cannot be used in file names.
+func fileNameOf(value string) string {
+
+	if value == "" {
+		return "_"
+	}
+
+	return invalidFileNamePattern.ReplaceAllString(value, "_")
+}
+
+func newRowSizer(headers []string, format Format) (*rowSizer, error) {
+
+	buffer := new(bytes.Buffer)
+	if format.OutputFormat == OutputFormatJSON {
+		// 2行目以降と同じく区切りを含めたバイト数とする
+		writer := &jsonRowWriter{writer: bufio.NewWriter(buffer), headers: headers, rows: 1}
+		return &rowSizer{buffer: buffer, writer: writer, flush: writer.writer.Flush}, nil
+	}
+
+	if format.OutputFormat == OutputFormatFixed {
+		writer := newFixedWidthRowWriter(buffer, format)
+		return &rowSizer{buffer: buffer, writer: writer, flush: writer.Flush}, nil
+	}
+
+	csvFormat := format
+	csvFormat.WithBom = false
+	csvWriter, err := newCSVWriter(buffer, csvFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &csvRowWriter{writer: csvWriter}
+	return &rowSizer{buffer: buffer, writer: writer, flush: csvWriter.Flush}, nil
+}
+
+// size returns the number of bytes of the row when it is written.
+func (s *rowSizer) size(values []*string) (int64, error) {
+
+	s.buffer.Reset()
+	if err := s.writer.Write(values); err != nil {
+		return 0, err
+	}
+	if err := s.flush(); err != nil {
+		return 0, err
+	}
+
+	return int64(s.buffer.Len()), nil
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const splitInput = `<root>
+<item><country>jp</country><id>1</id></item>
+<item><country>us</country><id>2</id></item>
+<item><country>jp</country><id>3</id></item>
+<item><country>a/b</country><id>4</id></item>
+<item><id>5</id></item>
+</root>`
+
+func TestRun_SplitRows(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", splitInput)
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "country=/country",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"-b",
+			"--split-rows", "2",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	assert.Equal(t, joinRows("\uFEFFcountry,id", "jp,1", "us,2"), readString(t, filepath.Join(temp, "output-1.csv")))
+	assert.Equal(t, joinRows("\uFEFFcountry,id", "jp,3", "a/b,4"), readString(t, filepath.Join(temp, "output-2.csv")))
+	assert.Equal(t, joinRows("\uFEFFcountry,id", ",5"), readString(t, filepath.Join(temp, "output-3.csv")))
+	assert.NoFileExists(t, outputPath)
+	assert.NoFileExists(t, filepath.Join(temp, "output-4.csv"))
+}
+
+func TestRun_SplitBy(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", splitInput)
+	outputPath := filepath.Join(temp, "out-{value}.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "country=/country",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"--split-by", "country",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// ファイル名に使えない文字や空の値は'_'となる
+	assert.Equal(t, joinRows("country,id", "jp,1", "jp,3"), readString(t, filepath.Join(temp, "out-jp.csv")))
+	assert.Equal(t, joinRows("country,id", "us,2"), readString(t, filepath.Join(temp, "out-us.csv")))
+	assert.Equal(t, joinRows("country,id", "a/b,4"), readString(t, filepath.Join(temp, "out-a_b.csv")))
+	assert.Equal(t, joinRows("country,id", ",5"), readString(t, filepath.Join(temp, "out-_.csv")))
+}
+
+func TestRun_SplitBy_WithRows(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", splitInput)
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "country=/country",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"--split-by", "country",
+			"--split-rows", "1",
+			"--where", "/country='jp'",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	assert.Equal(t, joinRows("country,id", "jp,1"), readString(t, filepath.Join(temp, "output-jp-1.csv")))
+	assert.Equal(t, joinRows("country,id", "jp,3"), readString(t, filepath.Join(temp, "output-jp-2.csv")))
+	assert.NoFileExists(t, filepath.Join(temp, "output-us-1.csv"))
+}
+
+func TestRun_SplitBytes(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", splitInput)
+	outputPath := filepath.Join(temp, "part{n}.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "country=/country",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"--split-bytes", "24",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// ヘッダ(12バイト)と行を合わせて24バイト以内
+	assert.Equal(t, joinRows("country,id", "jp,1", "us,2"), readString(t, filepath.Join(temp, "part1.csv")))
+	assert.Equal(t, joinRows("country,id", "jp,3"), readString(t, filepath.Join(temp, "part2.csv")))
+	assert.Equal(t, joinRows("country,id", "a/b,4", ",5"), readString(t, filepath.Join(temp, "part3.csv")))
+
+	for n := 1; n <= 3; n++ {
+		info, err := os.Stat(filepath.Join(temp, fmt.Sprintf("part%d.csv", n)))
+		require.NoError(t, err)
+		assert.LessOrEqual(t, info.Size(), int64(24))
+	}
+}
+
+func TestRun_SplitBytes_JSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", splitInput)
+	outputPath := filepath.Join(temp, "output.json")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "country=/country",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"--split-bytes", "80",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	expect1 := `[
+  {"country": "jp", "id": "1"},
+  {"country": "us", "id": "2"}
+]
+`
+	expect2 := `[
+  {"country": "jp", "id": "3"},
+  {"country": "a/b", "id": "4"}
+]
+`
+	expect3 := `[
+  {"country": null, "id": "5"}
+]
+`
+	assert.Equal(t, expect1, readString(t, filepath.Join(temp, "output-1.json")))
+	assert.Equal(t, expect2, readString(t, filepath.Join(temp, "output-2.json")))
+	assert.Equal(t, expect3, readString(t, filepath.Join(temp, "output-3.json")))
+}
+
+func TestRun_SplitBy_MaxOpenFiles(t *testing.T) {
+
+	// ARRANGE
+	original := maxOpenSplitFiles
+	maxOpenSplitFiles = 2
+	t.Cleanup(func() { maxOpenSplitFiles = original })
+
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+<item><country>jp</country><id>1</id></item>
+<item><country>us</country><id>2</id></item>
+<item><country>uk</country><id>3</id></item>
+<item><country>jp</country><id>4</id></item>
+<item><country>us</country><id>5</id></item>
+<item><country>jp</country><id>6</id></item>
+</root>`)
+
+	arguments := []string{
+		"-i", inputPath,
+		"-r", "//item",
+		"-c", "country=/country",
+		"-c", "id=/id",
+		"--split-by", "country",
+	}
+
+	// ACT
+	// 上限を超えると最も長く使われていないファイルを閉じ、追記で開き直す
+	csvOut := new(bytes.Buffer)
+	csvExitCode := run(append(arguments, "-o", filepath.Join(temp, "out-{value}.csv"), "-b"), csvOut)
+
+	jsonOut := new(bytes.Buffer)
+	jsonExitCode := run(append(arguments, "-o", filepath.Join(temp, "out-{value}.json")), jsonOut)
+
+	// ASSERT
+	require.Equal(t, OK, csvExitCode)
+	require.Empty(t, csvOut.String())
+
+	assert.Equal(t, joinRows("\uFEFFcountry,id", "jp,1", "jp,4", "jp,6"), readString(t, filepath.Join(temp, "out-jp.csv")))
+	assert.Equal(t, joinRows("\uFEFFcountry,id", "us,2", "us,5"), readString(t, filepath.Join(temp, "out-us.csv")))
+	assert.Equal(t, joinRows("\uFEFFcountry,id", "uk,3"), readString(t, filepath.Join(temp, "out-uk.csv")))
+
+	require.Equal(t, OK, jsonExitCode)
+	require.Empty(t, jsonOut.String())
+
+	expectJP := `[
+  {"country": "jp", "id": "1"},
+  {"country": "jp", "id": "4"},
+  {"country": "jp", "id": "6"}
+]
+`
+	expectUS := `[
+  {"country": "us", "id": "2"},
+  {"country": "us", "id": "5"}
+]
+`
+	expectUK := `[
+  {"country": "uk", "id": "3"}
+]
+`
+	assert.Equal(t, expectJP, readString(t, filepath.Join(temp, "out-jp.json")))
+	assert.Equal(t, expectUS, readString(t, filepath.Join(temp, "out-us.json")))
+	assert.Equal(t, expectUK, readString(t, filepath.Join(temp, "out-uk.json")))
+}
+
+func TestRun_SplitRows_Empty(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root></root>`)
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"--split-rows", "10",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	assert.Equal(t, joinRows("id"), readString(t, filepath.Join(temp, "output-1.csv")))
+}
+
+func TestRun_SplitBy_Duplicated(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root>
+	<item><id>a/b</id></item>
+	<item><id>a:b</id></item>
+	<item><id>a_b</id></item>
+	<item><id>a/b</id></item>
+	<item><id>_</id></item>
+	<item><id></id></item>
+	</root>`)
+	outputPath := filepath.Join(temp, "output.csv")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"--split-by", "id",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	// 置き換えた結果が同じファイル名になる場合は連番を付与
+	assert.Equal(t, joinRows("id", "a/b", "a/b"), readString(t, filepath.Join(temp, "output-a_b.csv")))
+	assert.Equal(t, joinRows("id", "a:b"), readString(t, filepath.Join(temp, "output-a_b_2.csv")))
+	assert.Equal(t, joinRows("id", "a_b"), readString(t, filepath.Join(temp, "output-a_b_3.csv")))
+	assert.Equal(t, joinRows("id", "_"), readString(t, filepath.Join(temp, "output-_.csv")))
+	assert.Equal(t, joinRows("id", ""), readString(t, filepath.Join(temp, "output-__2.csv")))
+}
+
+func TestRun_Split_Invalid(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		arguments []string
+		expect    string
+	}{
+		{
+			name:      "rows",
+			arguments: []string{"--split-rows", "-1"},
+			expect:    "Invalid split specification: rows must not be negative\n",
+		},
+		{
+			name:      "bytes",
+			arguments: []string{"--split-bytes", "10TB"},
+			expect:    "Invalid split specification: size must be a number with an optional unit (KB, MB, GB)\n",
+		},
+		{
+			name:      "by",
+			arguments: []string{"--split-by", "name"},
+			expect:    "Invalid split specification: split key 'name' is not a header of the output\n",
+		},
+		{
+			name:      "rows without number",
+			arguments: []string{"-o", "out-{value}.csv", "--split-by", "title", "--split-rows", "2"},
+			expect:    "Invalid split specification: output file name must contain '{n}' to split by rows or size\n",
+		},
+		{
+			name:      "bytes without number",
+			arguments: []string{"-o", "out-{value}.csv", "--split-by", "title", "--split-bytes", "1MB"},
+			expect:    "Invalid split specification: output file name must contain '{n}' to split by rows or size\n",
+		},
+		{
+			name:      "by without value",
+			arguments: []string{"-o", "out-{n}.csv", "--split-by", "title"},
+			expect:    "Invalid split specification: output file name must contain '{value}' to split by value\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			out := new(bytes.Buffer)
+
+			// ACT
+			exitCode := run(
+				append([]string{
+					"-i", "testdata/rss.xml",
+					"-m", "mapping/rss.json",
+					"-o", filepath.Join(temp, "output.csv"),
+				}, tt.arguments...),
+				out,
+			)
+
+			// ASSERT
+			require.Equal(t, NG, exitCode)
+			assert.Equal(t, tt.expect, out.String())
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+
+	tests := []struct {
+		value  string
+		expect int64
+	}{
+		{value: "100", expect: 100},
+		{value: "100B", expect: 100},
+		{value: "2k", expect: 2048},
+		{value: "100MB", expect: 100 * 1024 * 1024},
+		{value: " 1 GB ", expect: 1024 * 1024 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+
+			result, err := parseSize(tt.value)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, result)
+		})
+	}
+}
+
+func TestParseSize_Zero(t *testing.T) {
+
+	_, err := parseSize("0MB")
+	assert.EqualError(t, err, "size must be greater than 0")
+}
+
+func TestSplitTemplate(t *testing.T) {
+
+	assert.Equal(t, "out-{n}.csv", splitTemplate("out.csv", Split{Rows: 1}))
+	assert.Equal(t, "out-{value}.csv", splitTemplate("out.csv", Split{By: "country"}))
+	assert.Equal(t, "out-{value}-{n}.csv", splitTemplate("out.csv", Split{Bytes: 1, By: "country"}))
+	assert.Equal(t, "{value}/out.csv", splitTemplate("{value}/out.csv", Split{By: "country"}))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// processedState 変換済みのファイルの状態(次回以降は新しいファイルと変更されたファイルのみ変換)
+type processedState struct {
+	Files map[string]fileState `json:"files"`
+}
+
+// fileState 変換したときのファイルの状態
+type fileState struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash"`
+}
+
+// loadState loads the state file. If the file does not exist, an empty state is returned.
+func loadState(path string) (*processedState, error) {
+
+	state := &processedState{Files: map[string]fileState{}}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if state.Files == nil {
+		state.Files = map[string]fileState{}
+	}
+
+	return state, nil
+}
+
+// save writes the state file via a temporary file, so that the state file is not broken on failure.
+func (s *processedState) save(path string) error {
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(append(content, '\n')); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// changed returns the paths which are new or changed since the last time, and their current states.
+// URLs are always returned since their states cannot be determined.
+func (s *processedState) changed(paths []string) ([]string, map[string]fileState, error) {
+
+	var changedPaths []string
+	states := map[string]fileState{}
+	for _, path := range paths {
+		if isURL(path) {
+			changedPaths = append(changedPaths, path)
+			continue
+		}
+
+		key, err := filepath.Abs(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		previous, found := s.Files[key]
+		if found && previous.Size == info.Size() && previous.ModTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		// 更新日時のみ変わった場合は内容で判断
+		hash, err := hashFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		current := fileState{Size: info.Size(), ModTime: info.ModTime(), Hash: hash}
+		if found && previous.Size == current.Size && previous.Hash == current.Hash {
+			s.Files[key] = current
+			continue
+		}
+
+		changedPaths = append(changedPaths, path)
+		states[key] = current
+	}
+
+	return changedPaths, states, nil
+}
+
+// record records the states of the converted files.
+func (s *processedState) record(states map[string]fileState) {
+
+	for key, state := range states {
+		s.Files[key] = state
+	}
+}
+
+func hashFile(path string) (string, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
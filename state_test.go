@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_Append(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	input1Path := createFile(t, temp, "input1.xml", `<root><item><id>1</id></item></root>`)
+	input2Path := createFile(t, temp, "input2.xml", `<root><item><id>2</id></item><item><id>3</id></item></root>`)
+	outputPath := filepath.Join(temp, "output.csv")
+
+	// ACT
+	var exitCodes []int
+	out := new(bytes.Buffer)
+	for _, inputPath := range []string{input1Path, input2Path} {
+		exitCodes = append(exitCodes, run(
+			[]string{
+				"-i", inputPath,
+				"-r", "//item",
+				"-c", "id=/id",
+				"-o", outputPath,
+				"-b",
+				"--append",
+			},
+			out,
+		))
+	}
+
+	// ASSERT
+	require.Equal(t, []int{OK, OK}, exitCodes)
+	require.Empty(t, out.String())
+
+	// 追記時はヘッダとBOMを出力しない
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"\uFEFFid",
+		"1",
+		"2",
+		"3",
+	)
+
+	assert.Equal(t, expect, result)
+}
+
+func TestRun_Append_HeaderMismatch(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	inputPath := createFile(t, temp, "input.xml", `<root><item><id>1</id></item></root>`)
+	outputPath := createFile(t, temp, "output.csv", joinRows("id;name", "0;a"))
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", inputPath,
+			"-r", "//item",
+			"-c", "id=/id",
+			"-o", outputPath,
+			"-d", ";",
+			"--append",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+
+	expect := fmt.Sprintf("%s cannot be appended: header 'id;name' does not match 'id'\n", outputPath)
+	assert.Equal(t, expect, out.String())
+
+	// 既存のファイルは変更されない
+	assert.Equal(t, joinRows("id;name", "0;a"), readString(t, outputPath))
+}
+
+func TestRun_Append_JSON(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", filepath.Join(temp, "output.json"),
+			"--append",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "Invalid append specification: cannot be used with split or JSON output\n", out.String())
+}
+
+func TestRun_State(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "input")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	createFile(t, inputDir, "1.xml", `<root><item><id>1</id></item></root>`)
+	createFile(t, inputDir, "2.xml", `<root><item><id>2</id></item></root>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	statePath := filepath.Join(temp, "state.json")
+
+	convertInput := func() {
+		out := new(bytes.Buffer)
+		exitCode := run(
+			[]string{
+				"-i", inputDir,
+				"-r", "//item",
+				"-c", "id=/id",
+				"-o", outputPath,
+				"--append",
+				"--state", statePath,
+			},
+			out,
+		)
+		require.Equal(t, OK, exitCode)
+		require.Empty(t, out.String())
+	}
+
+	// ACT
+	convertInput()
+
+	// 変更無し
+	convertInput()
+
+	// 更新日時のみ変更、新しいファイル、内容の変更
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(inputDir, "1.xml"), later, later))
+	createFile(t, inputDir, "3.xml", `<root><item><id>3</id></item></root>`)
+	createFile(t, inputDir, "2.xml", `<root><item><id>2</id></item><item><id>22</id></item></root>`)
+	convertInput()
+
+	// ASSERT
+	result := readString(t, outputPath)
+	expect := joinRows(
+		"id",
+		"1",
+		"2",
+		"2",
+		"22",
+		"3",
+	)
+	assert.Equal(t, expect, result)
+
+	state, err := loadState(statePath)
+	require.NoError(t, err)
+	assert.Len(t, state.Files, 3)
+
+	key, err := filepath.Abs(filepath.Join(inputDir, "1.xml"))
+	require.NoError(t, err)
+	assert.True(t, state.Files[key].ModTime.Equal(later))
+	assert.Equal(t, int64(len(`<root><item><id>1</id></item></root>`)), state.Files[key].Size)
+}
+
+func TestRun_State_Invalid(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	statePath := createFile(t, temp, "state.json", `{"files": [`)
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", filepath.Join(temp, "output.csv"),
+			"--append",
+			"--state", statePath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, fmt.Sprintf("invalid state file %s: unexpected end of JSON input\n", statePath), out.String())
+}
+
+func TestRun_State_Unchanged(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputPath := createFile(t, temp, "input.xml", `<root><item><id>1</id></item><item><id>2</id></item></root>`)
+
+	outputPath := filepath.Join(temp, "output.csv")
+	arguments := []string{
+		"-i", inputPath,
+		"-r", "//item",
+		"-c", "id=/id",
+		"-o", outputPath,
+		"--append",
+		"--state", filepath.Join(temp, "state.json"),
+	}
+
+	// ACT
+	// 変更が無い場合も前回の行は残る
+	out := new(bytes.Buffer)
+	exitCode1 := run(arguments, out)
+	exitCode2 := run(arguments, out)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode1)
+	require.Equal(t, OK, exitCode2)
+	require.Empty(t, out.String())
+
+	assert.Equal(t, joinRows("id", "1", "2"), readString(t, outputPath))
+}
+
+func TestRun_State_WithoutAppend(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", filepath.Join(temp, "output.csv"),
+			"--state", filepath.Join(temp, "state.json"),
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "Invalid state specification: --state requires --append\n", out.String())
+	assert.NoFileExists(t, filepath.Join(temp, "state.json"))
+}
+
+func TestProcessedState_Changed_URL(t *testing.T) {
+
+	// ARRANGE
+	state := &processedState{Files: map[string]fileState{}}
+
+	// ACT
+	paths, states, err := state.changed([]string{"https://example.com/a.xml"})
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/a.xml"}, paths)
+	assert.Empty(t, states)
+}
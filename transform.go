@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// Transform カラムの値の変換(1つのTransformには1つの変換のみ指定)
+type Transform struct {
+	// Trim 前後の空白を除去
+	Trim bool `json:"trim,omitempty" yaml:"trim" toml:"trim"`
+	// CollapseWhitespace 連続する空白を1つのスペースに置換し、前後の空白を除去
+	CollapseWhitespace bool `json:"collapseWhitespace,omitempty" yaml:"collapseWhitespace" toml:"collapseWhitespace"`
+	// Uppercase 大文字に変換
+	Uppercase bool `json:"uppercase,omitempty" yaml:"uppercase" toml:"uppercase"`
+	// Lowercase 小文字に変換
+	Lowercase bool `json:"lowercase,omitempty" yaml:"lowercase" toml:"lowercase"`
+	// RegexReplace 正規表現での置換 [パターン, 置換文字列]
+	RegexReplace []string `json:"regexReplace,omitempty" yaml:"regexReplace" toml:"regexReplace"`
+	// Substring 部分文字列 [開始位置(0始まり), 文字数(省略時は末尾まで)]
+	Substring []int `json:"substring,omitempty" yaml:"substring" toml:"substring"`
+	// Map 値の置き換え(該当しない値はそのまま)
+	Map map[string]string `json:"map,omitempty" yaml:"map" toml:"map"`
+
+	regex *regexp.Regexp
+}
+
+// validateTransforms checks each transform has exactly one valid operation, and compiles the regular expressions.
+func validateTransforms(transforms []Transform) error {
+
+	for i := range transforms {
+		if err := transforms[i].validate(); err != nil {
+			return fmt.Errorf("transforms[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// applyTransforms applies the transforms to the value in order.
+func applyTransforms(value string, transforms []Transform) string {
+
+	for _, transform := range transforms {
+		value = transform.apply(value)
+	}
+
+	return value
+}
+
+func (t *Transform) validate() error {
+
+	operations := 0
+	for _, specified := range []bool{
+		t.Trim, t.CollapseWhitespace, t.Uppercase, t.Lowercase, t.RegexReplace != nil, t.Substring != nil, t.Map != nil,
+	} {
+		if specified {
+			operations++
+		}
+	}
+	if operations != 1 {
+		return fmt.Errorf("exactly one operation must be specified")
+	}
+
+	if t.RegexReplace != nil {
+		if len(t.RegexReplace) != 2 {
+			return fmt.Errorf("regexReplace must be [pattern, replacement]")
+		}
+
+		regex, err := regexp.Compile(t.RegexReplace[0])
+		if err != nil {
+			return fmt.Errorf("regexReplace pattern is invalid: %w", err)
+		}
+		t.regex = regex
+	}
+
+	if t.Substring != nil {
+		if len(t.Substring) < 1 || len(t.Substring) > 2 {
+			return fmt.Errorf("substring must be [start] or [start, length]")
+		}
+		for _, n := range t.Substring {
+			if n < 0 {
+				return fmt.Errorf("substring must not be negative")
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *Transform) apply(value string) string {
+
+	switch {
+	case t.Trim:
+		return strings.TrimSpace(value)
+	case t.CollapseWhitespace:
+		return strings.TrimSpace(whitespacePattern.ReplaceAllString(value, " "))
+	case t.Uppercase:
+		return strings.ToUpper(value)
+	case t.Lowercase:
+		return strings.ToLower(value)
+	case t.RegexReplace != nil:
+		regex := t.regex
+		if regex == nil {
+			// 検証を経由していない場合
+			regex = regexp.MustCompile(t.RegexReplace[0])
+		}
+		return regex.ReplaceAllString(value, t.RegexReplace[1])
+	case t.Substring != nil:
+		return substring(value, t.Substring)
+	case t.Map != nil:
+		if mapped, found := t.Map[value]; found {
+			return mapped
+		}
+	}
+
+	return value
+}
+
+// substring returns the substring in runes (not bytes).
+func substring(value string, positions []int) string {
+
+	runes := []rune(value)
+
+	start := min(positions[0], len(runes))
+	end := len(runes)
+	if len(positions) > 1 {
+		end = min(start+positions[1], len(runes))
+	}
+
+	return string(runes[start:end])
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTransforms_Trim(t *testing.T) {
+
+	transforms := []Transform{{Trim: true}}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "a  b", applyTransforms(" \n a  b\t ", transforms))
+}
+
+func TestApplyTransforms_CollapseWhitespace(t *testing.T) {
+
+	transforms := []Transform{{CollapseWhitespace: true}}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "a b c", applyTransforms(" \n a  b\n\tc ", transforms))
+}
+
+func TestApplyTransforms_Uppercase(t *testing.T) {
+
+	transforms := []Transform{{Uppercase: true}}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "ABC-Ä", applyTransforms("aBc-ä", transforms))
+}
+
+func TestApplyTransforms_Lowercase(t *testing.T) {
+
+	transforms := []Transform{{Lowercase: true}}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "abc-ä", applyTransforms("aBC-Ä", transforms))
+}
+
+func TestApplyTransforms_RegexReplace(t *testing.T) {
+
+	transforms := []Transform{{RegexReplace: []string{`(\d{4})(\d{2})(\d{2})`, "$1-$2-$3"}}}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "2024-01-31", applyTransforms("20240131", transforms))
+	assert.Equal(t, "none", applyTransforms("none", transforms))
+}
+
+func TestApplyTransforms_Substring(t *testing.T) {
+
+	transforms := []Transform{{Substring: []int{1, 2}}}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "いう", applyTransforms("あいうえお", transforms))
+	assert.Equal(t, "", applyTransforms("a", transforms))
+}
+
+func TestApplyTransforms_Substring_WithoutLength(t *testing.T) {
+
+	transforms := []Transform{{Substring: []int{3}}}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "def", applyTransforms("abcdef", transforms))
+	assert.Equal(t, "", applyTransforms("ab", transforms))
+}
+
+func TestApplyTransforms_Map(t *testing.T) {
+
+	transforms := []Transform{{Map: map[string]string{"Y": "yes", "N": "no"}}}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "yes", applyTransforms("Y", transforms))
+	assert.Equal(t, "no", applyTransforms("N", transforms))
+	assert.Equal(t, "X", applyTransforms("X", transforms))
+}
+
+func TestApplyTransforms_InOrder(t *testing.T) {
+
+	transforms := []Transform{
+		{Trim: true},
+		{Uppercase: true},
+		{Map: map[string]string{"Y": "yes", "N": "no"}},
+	}
+	require.NoError(t, validateTransforms(transforms))
+
+	assert.Equal(t, "yes", applyTransforms(" y ", transforms))
+}
+
+func TestValidateTransforms_NoOperation(t *testing.T) {
+
+	err := validateTransforms([]Transform{{Trim: true}, {}})
+
+	assert.EqualError(t, err, "transforms[1]: exactly one operation must be specified")
+}
+
+func TestValidateTransforms_MultipleOperations(t *testing.T) {
+
+	err := validateTransforms([]Transform{{Trim: true, Uppercase: true}})
+
+	assert.EqualError(t, err, "transforms[0]: exactly one operation must be specified")
+}
+
+func TestValidateTransforms_InvalidRegexReplace(t *testing.T) {
+
+	err := validateTransforms([]Transform{{RegexReplace: []string{"a"}}})
+	assert.EqualError(t, err, "transforms[0]: regexReplace must be [pattern, replacement]")
+
+	err = validateTransforms([]Transform{{RegexReplace: []string{"(", ""}}})
+	assert.EqualError(t, err, "transforms[0]: regexReplace pattern is invalid: error parsing regexp: missing closing ): `(`")
+}
+
+func TestValidateTransforms_InvalidSubstring(t *testing.T) {
+
+	err := validateTransforms([]Transform{{Substring: []int{}}})
+	assert.EqualError(t, err, "transforms[0]: substring must be [start] or [start, length]")
+
+	err = validateTransforms([]Transform{{Substring: []int{0, -1}}})
+	assert.EqualError(t, err, "transforms[0]: substring must not be negative")
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	flag "github.com/spf13/pflag"
+)
+
+// watcher 入力ディレクトリを監視し、追加されたファイルを変換
+type watcher struct {
+	inputDir  string
+	outputDir string
+	doneDir   string
+	failedDir string
+	mapping   *Mapping
+	format    Format
+	output    io.Writer
+	// pending 前回の確認時のファイルの状態(変化が無くなったら書き込みが完了したとみなす)
+	pending map[string]fileSnapshot
+	// state 変換済みのファイルの状態
+	state *processedState
+	// statePath 変換済みのファイルの状態を保存するファイル(空の場合は保存しない)
+	statePath string
+}
+
+type fileSnapshot struct {
+	size    int64
+	modTime time.Time
+}
+
+// renameFile ファイルの名前の変更(テストで差し替え)
+var renameFile = os.Rename
+
+func runWatch(arguments []string, output io.Writer) int {
+
+	var inputDir string
+	var mappingPath string
+	var outputDir string
+	var doneDir string
+	var failedDir string
+	var statePath string
+	var interval time.Duration
+	var polling bool
+	var once bool
+	var inputFormat string
+	var delimiter string
+	var withBom bool
+	var help bool
+
+	flagSet := flag.NewFlagSet("xml2csv watch", flag.ContinueOnError)
+
+	flagSet.StringVarP(&inputDir, "input", "i", "", "Input directory to watch")
+	flagSet.StringVarP(&mappingPath, "mapping", "m", "", "XML to CSV mapping file path or url")
+	flagSet.StringVarP(&outputDir, "output", "o", "", "CSV output directory")
+	flagSet.StringVar(&doneDir, "done", "", "(optional) Directory to move converted files to")
+	flagSet.StringVar(&failedDir, "failed", "", "(optional) Directory to move files failed to convert to")
+	flagSet.StringVar(&statePath, "state", "", "(optional) State file path to keep the converted files across restarts")
+	flagSet.DurationVar(&interval, "interval", time.Second, "(optional) Interval to check that files are completely written")
+	flagSet.BoolVar(&polling, "polling", false, "(optional) Poll the directory instead of file system notifications")
+	flagSet.BoolVar(&once, "once", false, "(optional) Convert the files in the directory and exit")
+	flagSet.StringVar(&inputFormat, "input-format", "", "(optional) Input format (xml, json, html) (default determined by extension)")
+	flagSet.StringVarP(&delimiter, "delimiter", "d", ",", "(optional) CSV output delimiter (e.g. ';' or '\\t' for tab)")
+	flagSet.BoolVarP(&withBom, "bom", "b", false, "(optional) CSV with BOM")
+	flagSet.BoolVarP(&help, "help", "h", false, "Help")
+
+	flagSet.SortFlags = false
+	flagSet.Usage = func() {
+		fmt.Fprintf(output, "xml2csv v%s (%s)\n\n", Version, Commit)
+		fmt.Fprint(output, "Usage: xml2csv watch [flags]\n\nFlags\n")
+		flagSet.PrintDefaults()
+		fmt.Fprintln(output)
+	}
+	flagSet.SetOutput(output)
+
+	if err := flagSet.Parse(arguments); err != nil {
+		flagSet.Usage()
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	delimiterRune, err := getDelimiterRune(delimiter)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid delimiter specification:", err)
+		return NG
+	}
+
+	parsedInputFormat, err := parseInputFormat(inputFormat)
+	if err != nil {
+		fmt.Fprintln(output, "Invalid input format specification:", err)
+		return NG
+	}
+
+	if help {
+		flagSet.Usage()
+		return OK
+	}
+
+	if inputDir == "" || mappingPath == "" || outputDir == "" || interval <= 0 {
+		flagSet.Usage()
+		return NG
+	}
+
+	mapping, err := loadMapping(mappingPath)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	w, err := newWatcher(inputDir, outputDir, doneDir, failedDir, statePath, mapping, Format{Delimiter: delimiterRune, WithBom: withBom, InputFormat: parsedInputFormat, NullValue: mapping.NullValue, Rejects: output}, output)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	if once {
+		// 書き込み中のファイルを除くため、間隔を空けて2回確認
+		w.scan()
+		time.Sleep(interval)
+		w.scan()
+		return OK
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := w.watch(ctx, interval, polling); err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	return OK
+}
+
+func newWatcher(inputDir string, outputDir string, doneDir string, failedDir string, statePath string, mapping *Mapping, format Format, output io.Writer) (*watcher, error) {
+
+	info, err := os.Stat(inputDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", inputDir)
+	}
+
+	for _, dir := range []string{outputDir, doneDir, failedDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	state := &processedState{Files: map[string]fileState{}}
+	if statePath != "" {
+		state, err = loadState(statePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &watcher{
+		inputDir:  inputDir,
+		outputDir: outputDir,
+		doneDir:   doneDir,
+		failedDir: failedDir,
+		mapping:   mapping,
+		format:    format,
+		output:    output,
+		pending:   map[string]fileSnapshot{},
+		state:     state,
+		statePath: statePath,
+	}, nil
+}
+
+// watch checks the directory at the interval until the context is canceled.
+// File system notifications trigger the check immediately, and polling is used if they are not available.
+func (w *watcher) watch(ctx context.Context, interval time.Duration, polling bool) error {
+
+	var events chan fsnotify.Event
+	if !polling {
+		notifier, err := fsnotify.NewWatcher()
+		if err == nil {
+			err = notifier.Add(w.inputDir)
+		}
+
+		if err != nil {
+			fmt.Fprintf(w.output, "file system notifications are not available, polling every %s: %v\n", interval, err)
+		} else {
+			defer notifier.Close()
+			events = notifier.Events
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	w.scan()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			w.scan()
+		case _, ok := <-events:
+			if !ok {
+				return fmt.Errorf("file system notifications are closed")
+			}
+			w.scan()
+		}
+	}
+}
+
+// scan converts the files which have not changed since the last scan, and records the others to check next time.
+func (w *watcher) scan() {
+
+	entries, err := os.ReadDir(w.inputDir)
+	if err != nil {
+		fmt.Fprintf(w.output, "failed: %s: %v\n", w.inputDir, err)
+		return
+	}
+
+	current := map[string]fileSnapshot{}
+	for _, entry := range entries {
+		// 隠しファイル(書き込み中の一時ファイルなど)は対象外
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// 確認中に移動、削除された場合
+			continue
+		}
+
+		path := filepath.Join(w.inputDir, entry.Name())
+		snapshot := fileSnapshot{size: info.Size(), modTime: info.ModTime()}
+		if processed, found := w.state.Files[stateKey(path)]; found && processed.Size == snapshot.size && processed.ModTime.Equal(snapshot.modTime) {
+			continue
+		}
+
+		if previous, found := w.pending[path]; found && previous == snapshot {
+			w.process(path)
+			continue
+		}
+
+		current[path] = snapshot
+	}
+
+	w.pending = current
+}
+
+// process converts the file, and moves it to the done or failed directory.
+// The file is recorded in the state, so it is not converted again until it is changed.
+func (w *watcher) process(path string) {
+
+	defer w.saveState()
+
+	changed, states, err := w.state.changed([]string{path})
+	if err != nil {
+		fmt.Fprintf(w.output, "failed: %s: %v\n", path, err)
+		return
+	}
+	if len(changed) == 0 {
+		// 更新日時のみ変わり、内容は変換済みの場合
+		return
+	}
+	w.state.record(states)
+
+	// 拡張子のみ異なるファイル(a.xmlとa.jsonなど)の出力が重ならないよう、ファイル名全体を使う
+	csvPath := filepath.Join(w.outputDir, filepath.Base(path)+".csv")
+
+	if err := w.convert(path, csvPath); err != nil {
+		fmt.Fprintf(w.output, "failed: %s: %v\n", path, err)
+		w.move(path, w.failedDir)
+		return
+	}
+
+	fmt.Fprintf(w.output, "converted: %s -> %s\n", path, csvPath)
+	w.move(path, w.doneDir)
+}
+
+// convert writes the CSV to a temporary file in the output directory and renames it,
+// so that a partially written CSV is never seen and the previous CSV is kept on failure.
+func (w *watcher) convert(path string, csvPath string) error {
+
+	// 隠しファイルとして作成
+	temp, err := os.CreateTemp(w.outputDir, "."+filepath.Base(csvPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := convert([]string{path}, w.mapping, temp, w.format); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(0644); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), csvPath)
+}
+
+func (w *watcher) saveState() {
+
+	if w.statePath == "" {
+		return
+	}
+
+	if err := w.state.save(w.statePath); err != nil {
+		fmt.Fprintf(w.output, "failed: %s: %v\n", w.statePath, err)
+	}
+}
+
+func (w *watcher) move(path string, dir string) {
+
+	if dir == "" {
+		return
+	}
+
+	if err := moveFile(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+		fmt.Fprintf(w.output, "failed: %s: %v\n", path, err)
+		return
+	}
+
+	delete(w.state.Files, stateKey(path))
+}
+
+// stateKey returns the key of the file in the state, which is the absolute path same as processedState.changed.
+func stateKey(path string) string {
+
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	return key
+}
+
+// moveFile renames the file. If the target is on another file system, the file is copied and then removed.
+func moveFile(source string, target string) error {
+
+	err := renameFile(source, target)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyFile(source, target); err != nil {
+		return err
+	}
+
+	return os.Remove(source)
+}
+
+// copyFile copies the file with its mode and modification time, via a temporary file in the target directory.
+func copyFile(source string, target string) error {
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, in); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(info.Mode().Perm()); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(temp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), target)
+}
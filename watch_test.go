@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const watchMapping = `
+{
+	"rowsPath": "//item",
+	"columns": [
+		{
+			"header": "id",
+			"valuePath": "/id",
+			"required": true
+		}
+	]
+}`
+
+func TestRunWatch_Once(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "inbox")
+	outputDir := filepath.Join(temp, "out")
+	doneDir := filepath.Join(temp, "done")
+	failedDir := filepath.Join(temp, "failed")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	mappingPath := createFile(t, temp, "mapping.json", watchMapping)
+	createFile(t, inputDir, "a.xml", `<root><item><id>1</id></item><item><id>2</id></item></root>`)
+	createFile(t, inputDir, "b.xml", `<root><item></item></root>`)
+	createFile(t, inputDir, ".c.xml", `<root><item><id>3</id></item></root>`)
+
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"watch",
+			"-i", inputDir,
+			"-m", mappingPath,
+			"-o", outputDir,
+			"--done", doneDir,
+			"--failed", failedDir,
+			"--interval", "10ms",
+			"--once",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	expect := fmt.Sprintf("converted: %s -> %s\n", filepath.Join(inputDir, "a.xml"), filepath.Join(outputDir, "a.xml.csv")) +
+		fmt.Sprintf("failed: %s: %s is failed: row 1: column 'id' is required\n", filepath.Join(inputDir, "b.xml"), filepath.Join(inputDir, "b.xml"))
+	assert.Equal(t, expect, out.String())
+
+	assert.Equal(t, joinRows("id", "1", "2"), readString(t, filepath.Join(outputDir, "a.xml.csv")))
+	assert.NoFileExists(t, filepath.Join(outputDir, "b.xml.csv"))
+
+	assert.FileExists(t, filepath.Join(doneDir, "a.xml"))
+	assert.FileExists(t, filepath.Join(failedDir, "b.xml"))
+	assert.FileExists(t, filepath.Join(inputDir, ".c.xml"))
+	assert.NoFileExists(t, filepath.Join(inputDir, "a.xml"))
+	assert.NoFileExists(t, filepath.Join(inputDir, "b.xml"))
+}
+
+func TestRunWatch_NullValue(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "inbox")
+	outputDir := filepath.Join(temp, "out")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	mappingPath := createFile(t, temp, "mapping.json", `
+	{
+		"rowsPath": "//item",
+		"columns": [
+			{"header": "id", "valuePath": "/id"},
+			{"header": "name", "valuePath": "/name"}
+		],
+		"nullValue": "NULL"
+	}`)
+	createFile(t, inputDir, "a.xml", `<root><item><id>1</id><name>a</name></item><item><id>2</id></item></root>`)
+
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"watch",
+			"-i", inputDir,
+			"-m", mappingPath,
+			"-o", outputDir,
+			"--interval", "10ms",
+			"--once",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	// マッピングのnullValueを使って出力
+	assert.Equal(t, joinRows("id,name", "1,a", "2,NULL"), readString(t, filepath.Join(outputDir, "a.xml.csv")))
+}
+
+func TestRunWatch_State(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "inbox")
+	outputDir := filepath.Join(temp, "out")
+	statePath := filepath.Join(temp, "state.json")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	mappingPath := createFile(t, temp, "mapping.json", watchMapping)
+	inputPath := createFile(t, inputDir, "a.xml", `<root><item><id>1</id></item></root>`)
+
+	watch := func() string {
+		out := new(bytes.Buffer)
+		exitCode := run(
+			[]string{
+				"watch",
+				"-i", inputDir,
+				"-m", mappingPath,
+				"-o", outputDir,
+				"--state", statePath,
+				"--interval", "10ms",
+				"--once",
+			},
+			out,
+		)
+		require.Equal(t, OK, exitCode)
+		return out.String()
+	}
+
+	// ACT/ASSERT
+	converted := fmt.Sprintf("converted: %s -> %s\n", inputPath, filepath.Join(outputDir, "a.xml.csv"))
+	assert.Equal(t, converted, watch())
+
+	// 再起動しても変換済みのファイルは再度変換しない
+	require.NoError(t, os.Remove(filepath.Join(outputDir, "a.xml.csv")))
+	assert.Equal(t, "", watch())
+	assert.NoFileExists(t, filepath.Join(outputDir, "a.xml.csv"))
+
+	// 更新日時のみ変わった場合も変換しない
+	modTime := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(inputPath, modTime, modTime))
+	assert.Equal(t, "", watch())
+
+	// 内容が変わった場合は変換
+	createFile(t, inputDir, "a.xml", `<root><item><id>2</id></item></root>`)
+	assert.Equal(t, converted, watch())
+	assert.Equal(t, joinRows("id", "2"), readString(t, filepath.Join(outputDir, "a.xml.csv")))
+}
+
+func TestRunWatch_SameBaseName(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "inbox")
+	outputDir := filepath.Join(temp, "out")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	mappingPath := createFile(t, temp, "mapping.json", watchMapping)
+	createFile(t, inputDir, "a.xml", `<root><item><id>1</id></item></root>`)
+	createFile(t, inputDir, "a.txt", `<root><item><id>2</id></item></root>`)
+
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"watch",
+			"-i", inputDir,
+			"-m", mappingPath,
+			"-o", outputDir,
+			"--input-format", "xml",
+			"--interval", "10ms",
+			"--once",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	// 拡張子のみ異なるファイルの出力は重ならない
+	assert.Equal(t, joinRows("id", "1"), readString(t, filepath.Join(outputDir, "a.xml.csv")))
+	assert.Equal(t, joinRows("id", "2"), readString(t, filepath.Join(outputDir, "a.txt.csv")))
+
+	// 一時ファイルは残らない
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestMoveFile_CrossDevice(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	source := createFile(t, temp, "a.xml", "<root/>")
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(source, modTime, modTime))
+
+	targetDir := filepath.Join(temp, "done")
+	require.NoError(t, os.Mkdir(targetDir, 0755))
+	target := filepath.Join(targetDir, "a.xml")
+
+	// 別のファイルシステムへの名前の変更は失敗する
+	original := renameFile
+	renameFile = func(oldpath string, newpath string) error {
+		if filepath.Dir(newpath) == targetDir {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+		}
+		return original(oldpath, newpath)
+	}
+	t.Cleanup(func() { renameFile = original })
+
+	// ACT
+	err := moveFile(source, target)
+
+	// ASSERT
+	require.NoError(t, err)
+	assert.NoFileExists(t, source)
+	assert.Equal(t, "<root/>", readString(t, target))
+
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(info.ModTime()))
+
+	entries, err := os.ReadDir(targetDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRunWatch_NotDirectory(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"watch",
+			"-i", "testdata/rss.xml",
+			"-m", "mapping/rss.json",
+			"-o", temp,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "testdata/rss.xml is not a directory\n", out.String())
+}
+
+func TestWatcher_Scan_Incomplete(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+	inputDir := filepath.Join(temp, "inbox")
+	outputDir := filepath.Join(temp, "out")
+	require.NoError(t, os.Mkdir(inputDir, 0755))
+
+	mapping, err := loadMapping(createFile(t, temp, "mapping.json", watchMapping))
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	w, err := newWatcher(inputDir, outputDir, "", "", "", mapping, Format{Delimiter: ','}, out)
+	require.NoError(t, err)
+
+	inputPath := createFile(t, inputDir, "a.xml", `<root><item><id>1</id></item>`)
+
+	// ACT/ASSERT
+	// 最初の確認では変換しない
+	w.scan()
+	assert.NoFileExists(t, filepath.Join(outputDir, "a.xml.csv"))
+
+	// 書き込み中(前回から変化がある)の場合は変換しない
+	createFile(t, inputDir, "a.xml", `<root><item><id>1</id></item></root>`)
+	w.scan()
+	assert.NoFileExists(t, filepath.Join(outputDir, "a.xml.csv"))
+
+	// 変化が無くなったら変換
+	w.scan()
+	assert.Equal(t, joinRows("id", "1"), readString(t, filepath.Join(outputDir, "a.xml.csv")))
+
+	// 変換済みのファイルは再度変換しない
+	require.NoError(t, os.Remove(filepath.Join(outputDir, "a.xml.csv")))
+	w.scan()
+	w.scan()
+	assert.NoFileExists(t, filepath.Join(outputDir, "a.xml.csv"))
+	assert.FileExists(t, inputPath)
+
+	assert.Equal(t, fmt.Sprintf("converted: %s -> %s\n", inputPath, filepath.Join(outputDir, "a.xml.csv")), out.String())
+}
+
+func TestWatcher_Watch(t *testing.T) {
+
+	for _, polling := range []bool{false, true} {
+		t.Run(fmt.Sprintf("polling=%v", polling), func(t *testing.T) {
+
+			// ARRANGE
+			temp := t.TempDir()
+			inputDir := filepath.Join(temp, "inbox")
+			outputDir := filepath.Join(temp, "out")
+			doneDir := filepath.Join(temp, "done")
+			require.NoError(t, os.Mkdir(inputDir, 0755))
+
+			mapping, err := loadMapping(createFile(t, temp, "mapping.json", watchMapping))
+			require.NoError(t, err)
+
+			w, err := newWatcher(inputDir, outputDir, doneDir, "", "", mapping, Format{Delimiter: ','}, new(bytes.Buffer))
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- w.watch(ctx, 20*time.Millisecond, polling)
+			}()
+
+			// ACT
+			createFile(t, inputDir, "a.xml", `<root><item><id>1</id></item></root>`)
+
+			// ASSERT
+			assert.Eventually(t, func() bool {
+				_, err := os.Stat(filepath.Join(doneDir, "a.xml"))
+				return err == nil
+			}, 5*time.Second, 10*time.Millisecond)
+
+			cancel()
+			require.NoError(t, <-done)
+
+			assert.Equal(t, joinRows("id", "1"), readString(t, filepath.Join(outputDir, "a.xml.csv")))
+		})
+	}
+}
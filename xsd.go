@@ -0,0 +1,555 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// XSDの組み込み型とカラムのデータ型の対応
+var xsdBuiltinTypes = map[string]string{
+	"string":             "string",
+	"normalizedString":   "string",
+	"token":              "string",
+	"anyURI":             "string",
+	"ID":                 "string",
+	"IDREF":              "string",
+	"NCName":             "string",
+	"Name":               "string",
+	"language":           "string",
+	"int":                "integer",
+	"integer":            "integer",
+	"long":               "integer",
+	"short":              "integer",
+	"byte":               "integer",
+	"nonNegativeInteger": "integer",
+	"nonPositiveInteger": "integer",
+	"positiveInteger":    "integer",
+	"negativeInteger":    "integer",
+	"unsignedInt":        "integer",
+	"unsignedLong":       "integer",
+	"unsignedShort":      "integer",
+	"unsignedByte":       "integer",
+	"decimal":            "number",
+	"float":              "number",
+	"double":             "number",
+	"boolean":            "boolean",
+	"date":               "date",
+	"dateTime":           "datetime",
+	"time":               "time",
+}
+
+type xsdSchema struct {
+	Elements     []*xsdElement     `xml:"element"`
+	ComplexTypes []*xsdComplexType `xml:"complexType"`
+	SimpleTypes  []*xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	Ref         string          `xml:"ref,attr"`
+	MinOccurs   string          `xml:"minOccurs,attr"`
+	MaxOccurs   string          `xml:"maxOccurs,attr"`
+	ComplexType *xsdComplexType `xml:"complexType"`
+	SimpleType  *xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdComplexType struct {
+	Name           string          `xml:"name,attr"`
+	Mixed          bool            `xml:"mixed,attr"`
+	Sequence       *xsdGroup       `xml:"sequence"`
+	All            *xsdGroup       `xml:"all"`
+	Choice         *xsdGroup       `xml:"choice"`
+	Attributes     []*xsdAttribute `xml:"attribute"`
+	AnyAttribute   *struct{}       `xml:"anyAttribute"`
+	SimpleContent  *xsdContent     `xml:"simpleContent"`
+	ComplexContent *xsdContent     `xml:"complexContent"`
+}
+
+type xsdGroup struct {
+	// XMLName sequence, all, choice のいずれか
+	XMLName   xml.Name
+	MinOccurs string        `xml:"minOccurs,attr"`
+	MaxOccurs string        `xml:"maxOccurs,attr"`
+	Elements  []*xsdElement `xml:"element"`
+	Sequences []*xsdGroup   `xml:"sequence"`
+	Choices   []*xsdGroup   `xml:"choice"`
+	Any       []*struct{}   `xml:"any"`
+}
+
+type xsdContent struct {
+	Extension   *xsdDerivation `xml:"extension"`
+	Restriction *xsdDerivation `xml:"restriction"`
+}
+
+type xsdDerivation struct {
+	Base       string          `xml:"base,attr"`
+	Sequence   *xsdGroup       `xml:"sequence"`
+	All        *xsdGroup       `xml:"all"`
+	Choice     *xsdGroup       `xml:"choice"`
+	Attributes []*xsdAttribute `xml:"attribute"`
+}
+
+type xsdAttribute struct {
+	Name       string         `xml:"name,attr"`
+	Type       string         `xml:"type,attr"`
+	Ref        string         `xml:"ref,attr"`
+	Use        string         `xml:"use,attr"`
+	SimpleType *xsdSimpleType `xml:"simpleType"`
+}
+
+type xsdSimpleType struct {
+	Name        string          `xml:"name,attr"`
+	Restriction *xsdRestriction `xml:"restriction"`
+}
+
+type xsdRestriction struct {
+	Base         string      `xml:"base,attr"`
+	Enumerations []*xsdFacet `xml:"enumeration"`
+	Patterns     []*xsdFacet `xml:"pattern"`
+	MinInclusive *xsdFacet   `xml:"minInclusive"`
+	MaxInclusive *xsdFacet   `xml:"maxInclusive"`
+	MinExclusive *xsdFacet   `xml:"minExclusive"`
+	MaxExclusive *xsdFacet   `xml:"maxExclusive"`
+	Length       *xsdFacet   `xml:"length"`
+	MinLength    *xsdFacet   `xml:"minLength"`
+	MaxLength    *xsdFacet   `xml:"maxLength"`
+}
+
+type xsdFacet struct {
+	Value string `xml:"value,attr"`
+}
+
+func runXSD(arguments []string, output io.Writer) int {
+
+	var schemaPath string
+	var elementName string
+	var mappingPath string
+	var help bool
+
+	flagSet := flag.NewFlagSet("xml2csv xsd", flag.ContinueOnError)
+
+	flagSet.StringVarP(&schemaPath, "input", "i", "", "XSD file path or url")
+	flagSet.StringVarP(&elementName, "element", "e", "", "(optional) Name of the repeating element to be rows")
+	flagSet.StringVarP(&mappingPath, "output", "o", "", "(optional) Mapping output file path (default stdout)")
+	flagSet.BoolVarP(&help, "help", "h", false, "Help")
+
+	flagSet.SortFlags = false
+	flagSet.Usage = func() {
+		fmt.Fprintf(output, "xml2csv v%s (%s)\n\n", Version, Commit)
+		fmt.Fprint(output, "Usage: xml2csv xsd [flags]\n\nFlags\n")
+		flagSet.PrintDefaults()
+		fmt.Fprintln(output)
+	}
+	flagSet.SetOutput(output)
+
+	if err := flagSet.Parse(arguments); err != nil {
+		flagSet.Usage()
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	if help {
+		flagSet.Usage()
+		return OK
+	}
+
+	if schemaPath == "" {
+		flagSet.Usage()
+		return NG
+	}
+
+	schema, err := loadXSD(schemaPath)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	mapping, err := schema.mapping(elementName)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	writer := output
+	if mappingPath != "" {
+		mappingFile, err := os.Create(mappingPath)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return NG
+		}
+		defer mappingFile.Close()
+
+		writer = mappingFile
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "    ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(mapping); err != nil {
+		fmt.Fprintln(output, err)
+		return NG
+	}
+
+	return OK
+}
+
+func loadXSD(path string) (*xsdSchema, error) {
+
+	reader, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var schema xsdSchema
+	if err := xml.NewDecoder(reader).Decode(&schema); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+
+	return &schema, nil
+}
+
+// mapping generates the mapping whose rows are the specified element.
+// If the element is not specified, the only repeating element in the schema is used.
+func (s *xsdSchema) mapping(elementName string) (*Mapping, error) {
+
+	var candidates []*xsdElement
+	s.walkElements(func(element *xsdElement, repeated bool) {
+		if elementName != "" && element.Name == elementName {
+			candidates = append(candidates, element)
+		} else if elementName == "" && repeated {
+			candidates = append(candidates, element)
+		}
+	})
+
+	if len(candidates) == 0 {
+		if elementName != "" {
+			return nil, fmt.Errorf("element '%s' is not found in schema", elementName)
+		}
+		return nil, fmt.Errorf("repeating element is not found in schema")
+	}
+
+	row := candidates[0]
+	if elementName == "" && len(candidates) > 1 {
+		var names []string
+		for _, candidate := range candidates {
+			names = append(names, candidate.Name)
+		}
+		return nil, fmt.Errorf("multiple repeating elements are found, specify one of them: %s", strings.Join(names, ", "))
+	}
+
+	columns := newColumnBuilder()
+	s.addColumns(columns, row, "", map[*xsdComplexType]bool{})
+
+	return &Mapping{
+		RowsPath: "//" + row.Name,
+		Columns:  columns.columns,
+	}, nil
+}
+
+// walkElements calls fn for all named elements in the schema, with whether the element can be repeated.
+func (s *xsdSchema) walkElements(fn func(element *xsdElement, repeated bool)) {
+
+	visitedTypes := map[*xsdComplexType]bool{}
+
+	var walkElement func(element *xsdElement, repeated bool)
+	var walkGroup func(group *xsdGroup, repeated bool)
+	walkComplexType := func(complexType *xsdComplexType) {
+		if complexType == nil || visitedTypes[complexType] {
+			return
+		}
+		visitedTypes[complexType] = true
+
+		for _, group := range complexType.groups() {
+			walkGroup(group, false)
+		}
+	}
+
+	walkElement = func(element *xsdElement, repeated bool) {
+		if element.Name == "" {
+			return
+		}
+
+		fn(element, repeated || isRepeated(element.MaxOccurs))
+		walkComplexType(s.complexTypeOf(element))
+	}
+
+	walkGroup = func(group *xsdGroup, repeated bool) {
+		repeated = repeated || isRepeated(group.MaxOccurs)
+		for _, element := range group.Elements {
+			if element.Ref != "" {
+				// 参照先のグローバル要素が繰り返しとなる
+				if referenced := s.element(element.Ref); referenced != nil && (repeated || isRepeated(element.MaxOccurs)) {
+					fn(referenced, true)
+				}
+				continue
+			}
+			walkElement(element, repeated)
+		}
+		for _, child := range append(group.Sequences, group.Choices...) {
+			walkGroup(child, repeated)
+		}
+	}
+
+	for _, element := range s.Elements {
+		walkElement(element, false)
+	}
+}
+
+func (s *xsdSchema) addColumns(columns *columnBuilder, element *xsdElement, path string, visited map[*xsdComplexType]bool) {
+
+	// 行の要素自身のテキストは要素名をヘッダとする
+	header, valuePath := headerOf(path), path
+	if path == "" {
+		header, valuePath = element.Name, "."
+	}
+
+	complexType := s.complexTypeOf(element)
+	if complexType == nil {
+		// 単純型
+		columns.add(header, valuePath, s.columnType(element.Type, element.SimpleType))
+		return
+	}
+
+	if visited[complexType] {
+		// 再帰的な定義は展開しない
+		return
+	}
+	visited[complexType] = true
+	defer delete(visited, complexType)
+
+	if complexType.SimpleContent != nil {
+		// テキストと属性を持つ要素
+		columns.add(header, valuePath, s.columnType(complexType.SimpleContent.base(), nil))
+	}
+
+	for _, attribute := range s.attributesOf(complexType) {
+		if attribute.Ref != "" {
+			attribute = &xsdAttribute{Name: localName(attribute.Ref)}
+		}
+
+		header := attribute.Name
+		if path != "" {
+			header = headerOf(path) + "_" + attribute.Name
+		}
+		columns.add(header, path+"/@"+attribute.Name, s.columnType(attribute.Type, attribute.SimpleType))
+	}
+
+	for _, group := range s.groupsOf(complexType) {
+		s.addGroupColumns(columns, group, path, visited)
+	}
+}
+
+func (s *xsdSchema) addGroupColumns(columns *columnBuilder, group *xsdGroup, path string, visited map[*xsdComplexType]bool) {
+
+	for _, element := range group.Elements {
+		if element.Ref != "" {
+			element = s.element(element.Ref)
+			if element == nil {
+				continue
+			}
+		}
+		s.addColumns(columns, element, path+"/"+element.Name, visited)
+	}
+
+	for _, child := range append(group.Sequences, group.Choices...) {
+		s.addGroupColumns(columns, child, path, visited)
+	}
+}
+
+// attributesOf returns the attributes of the complex type, including the ones of the base type.
+func (s *xsdSchema) attributesOf(complexType *xsdComplexType) []*xsdAttribute {
+
+	var attributes []*xsdAttribute
+	for _, current := range s.typeHierarchy(complexType) {
+		for _, content := range []*xsdContent{current.SimpleContent, current.ComplexContent} {
+			if derivation := content.derivation(); derivation != nil {
+				attributes = append(attributes, derivation.Attributes...)
+			}
+		}
+		attributes = append(attributes, current.Attributes...)
+	}
+
+	return attributes
+}
+
+// groupsOf returns the model groups of the complex type, including the ones of the base type.
+func (s *xsdSchema) groupsOf(complexType *xsdComplexType) []*xsdGroup {
+
+	var groups []*xsdGroup
+	for _, current := range s.typeHierarchy(complexType) {
+		if derivation := current.ComplexContent.derivation(); derivation != nil {
+			groups = appendGroups(groups, derivation.Sequence, derivation.All, derivation.Choice)
+		}
+		groups = appendGroups(groups, current.Sequence, current.All, current.Choice)
+	}
+
+	return groups
+}
+
+// typeHierarchy returns the complex type and its base types, starting from the root base type.
+// A base type which is already in the hierarchy is ignored, so that a cyclic derivation does not loop.
+func (s *xsdSchema) typeHierarchy(complexType *xsdComplexType) []*xsdComplexType {
+
+	hierarchy := []*xsdComplexType{complexType}
+	for current := complexType; ; {
+		base := s.complexType(current.SimpleContent.base())
+		if base == nil {
+			base = s.complexType(current.ComplexContent.base())
+		}
+		if base == nil || slices.Contains(hierarchy, base) {
+			break
+		}
+
+		hierarchy = append(hierarchy, base)
+		current = base
+	}
+
+	slices.Reverse(hierarchy)
+	return hierarchy
+}
+
+func (s *xsdSchema) complexTypeOf(element *xsdElement) *xsdComplexType {
+
+	if element.ComplexType != nil {
+		return element.ComplexType
+	}
+
+	return s.complexType(element.Type)
+}
+
+func (s *xsdSchema) complexType(name string) *xsdComplexType {
+
+	if name == "" {
+		return nil
+	}
+
+	for _, complexType := range s.ComplexTypes {
+		if complexType.Name == localName(name) {
+			return complexType
+		}
+	}
+
+	return nil
+}
+
+func (s *xsdSchema) element(name string) *xsdElement {
+
+	for _, element := range s.Elements {
+		if element.Name == localName(name) {
+			return element
+		}
+	}
+
+	return nil
+}
+
+// columnType resolves the type name (or the inline simple type) to the column type.
+func (s *xsdSchema) columnType(typeName string, simpleType *xsdSimpleType) string {
+
+	// 制限による派生は、組み込み型に到達するまで基底型をたどる
+	for depth := 0; depth < 100; depth++ {
+		if simpleType != nil {
+			if simpleType.Restriction == nil {
+				// list, union
+				return "string"
+			}
+			typeName = simpleType.Restriction.Base
+			simpleType = nil
+			continue
+		}
+
+		if typeName == "" {
+			return "string"
+		}
+
+		for _, named := range s.SimpleTypes {
+			if named.Name == localName(typeName) {
+				simpleType = named
+				break
+			}
+		}
+		if simpleType != nil {
+			continue
+		}
+
+		if columnType, found := xsdBuiltinTypes[localName(typeName)]; found {
+			return columnType
+		}
+		return "string"
+	}
+
+	return "string"
+}
+
+func (c *xsdComplexType) groups() []*xsdGroup {
+
+	groups := appendGroups(nil, c.Sequence, c.All, c.Choice)
+	for _, content := range []*xsdContent{c.SimpleContent, c.ComplexContent} {
+		if derivation := content.derivation(); derivation != nil {
+			groups = appendGroups(groups, derivation.Sequence, derivation.All, derivation.Choice)
+		}
+	}
+
+	return groups
+}
+
+func (c *xsdContent) derivation() *xsdDerivation {
+
+	if c == nil {
+		return nil
+	}
+	if c.Extension != nil {
+		return c.Extension
+	}
+
+	return c.Restriction
+}
+
+func (c *xsdContent) base() string {
+
+	if derivation := c.derivation(); derivation != nil {
+		return derivation.Base
+	}
+
+	return ""
+}
+
+func appendGroups(groups []*xsdGroup, candidates ...*xsdGroup) []*xsdGroup {
+
+	for _, candidate := range candidates {
+		if candidate != nil {
+			groups = append(groups, candidate)
+		}
+	}
+
+	return groups
+}
+
+func isRepeated(maxOccurs string) bool {
+
+	if maxOccurs == "unbounded" {
+		return true
+	}
+
+	n, err := strconv.Atoi(maxOccurs)
+	return err == nil && n > 1
+}
+
+func localName(name string) string {
+
+	if _, local, found := strings.Cut(name, ":"); found {
+		return local
+	}
+
+	return name
+}
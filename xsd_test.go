@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunXSD(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"xsd",
+			"-i", "testdata/xsd/orders.xsd",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+
+	var result Mapping
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+
+	expect := Mapping{
+		RowsPath: "//order",
+		Columns: []Column{
+			{Header: "id", ValuePath: "/@id", Type: "integer"},
+			{Header: "orderedAt", ValuePath: "/orderedAt", Type: "datetime"},
+			{Header: "customer_name", ValuePath: "/customer/name", Type: "string"},
+			{Header: "customer_birthday", ValuePath: "/customer/birthday", Type: "date"},
+			{Header: "amount", ValuePath: "/amount", Type: "number"},
+			{Header: "amount_currency", ValuePath: "/amount/@currency", Type: "string"},
+			{Header: "status", ValuePath: "/status", Type: "string"},
+			{Header: "paid", ValuePath: "/paid", Type: "boolean"},
+		},
+	}
+	assert.Equal(t, expect, result)
+}
+
+func TestRunXSD_Element(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	mappingPath := filepath.Join(temp, "mapping.json")
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"xsd",
+			"-i", "testdata/xsd/orders.xsd",
+			"-e", "customer",
+			"-o", mappingPath,
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, OK, exitCode)
+	require.Empty(t, out.String())
+
+	result, err := loadMapping(mappingPath)
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//customer",
+		Columns: []Column{
+			{Header: "name", ValuePath: "/name", Type: "string"},
+			{Header: "birthday", ValuePath: "/birthday", Type: "date"},
+		},
+	}
+	assert.Equal(t, expect, result)
+}
+
+func TestRunXSD_ElementNotFound(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"xsd",
+			"-i", "testdata/xsd/orders.xsd",
+			"-e", "item",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Equal(t, "element 'item' is not found in schema\n", out.String())
+}
+
+func TestRunXSD_NoneInput(t *testing.T) {
+
+	// ARRANGE
+	out := new(bytes.Buffer)
+
+	// ACT
+	exitCode := run(
+		[]string{
+			"xsd",
+		},
+		out,
+	)
+
+	// ASSERT
+	require.Equal(t, NG, exitCode)
+	assert.Contains(t, out.String(), "Usage: xml2csv xsd [flags]")
+}
+
+func TestXSDMapping_RefAndExtension(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	schemaPath := createFile(t, temp, "schema.xsd", `<?xml version="1.0"?>
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+  <xsd:complexType name="base">
+    <xsd:sequence>
+      <xsd:element name="code" type="xsd:long"/>
+    </xsd:sequence>
+    <xsd:attribute name="version" type="xsd:short"/>
+  </xsd:complexType>
+  <xsd:element name="note" type="xsd:string"/>
+  <xsd:element name="list">
+    <xsd:complexType>
+      <xsd:sequence maxOccurs="unbounded">
+        <xsd:element name="entry">
+          <xsd:complexType>
+            <xsd:complexContent>
+              <xsd:extension base="base">
+                <xsd:sequence>
+                  <xsd:element ref="note"/>
+                  <xsd:element name="price" type="xsd:double"/>
+                </xsd:sequence>
+              </xsd:extension>
+            </xsd:complexContent>
+          </xsd:complexType>
+        </xsd:element>
+      </xsd:sequence>
+    </xsd:complexType>
+  </xsd:element>
+</xsd:schema>`)
+
+	schema, err := loadXSD(schemaPath)
+	require.NoError(t, err)
+
+	// ACT
+	result, err := schema.mapping("")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//entry",
+		Columns: []Column{
+			{Header: "version", ValuePath: "/@version", Type: "integer"},
+			{Header: "code", ValuePath: "/code", Type: "integer"},
+			{Header: "note", ValuePath: "/note", Type: "string"},
+			{Header: "price", ValuePath: "/price", Type: "number"},
+		},
+	}
+	assert.Equal(t, expect, result)
+}
+
+func TestXSDMapping_MultipleRepeatingElements(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	schemaPath := createFile(t, temp, "schema.xsd", `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="root">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="a" type="xs:string" maxOccurs="unbounded"/>
+        <xs:element name="b" type="xs:string" maxOccurs="2"/>
+        <xs:element name="c" type="xs:string" maxOccurs="1"/>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`)
+
+	schema, err := loadXSD(schemaPath)
+	require.NoError(t, err)
+
+	// ACT
+	_, err = schema.mapping("")
+
+	// ASSERT
+	require.EqualError(t, err, "multiple repeating elements are found, specify one of them: a, b")
+}
+
+func TestXSDMapping_SimpleContentRow(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	schemaPath := createFile(t, temp, "schema.xsd", `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="prices">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="price" maxOccurs="unbounded">
+          <xs:complexType>
+            <xs:simpleContent>
+              <xs:extension base="xs:decimal">
+                <xs:attribute name="currency" type="xs:string"/>
+              </xs:extension>
+            </xs:simpleContent>
+          </xs:complexType>
+        </xs:element>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`)
+
+	schema, err := loadXSD(schemaPath)
+	require.NoError(t, err)
+
+	// ACT
+	result, err := schema.mapping("")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	// 行の要素自身のテキスト
+	expect := &Mapping{
+		RowsPath: "//price",
+		Columns: []Column{
+			{Header: "price", ValuePath: ".", Type: "number"},
+			{Header: "currency", ValuePath: "/@currency", Type: "string"},
+		},
+	}
+	assert.Equal(t, expect, result)
+}
+
+func TestXSDMapping_SimpleTypeRow(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	schemaPath := createFile(t, temp, "schema.xsd", `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="tags">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="tag" type="xs:string" maxOccurs="unbounded"/>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`)
+	inputPath := createFile(t, temp, "input.xml", `<tags><tag>a</tag><tag>b</tag></tags>`)
+
+	schema, err := loadXSD(schemaPath)
+	require.NoError(t, err)
+
+	// ACT
+	result, err := schema.mapping("")
+
+	// ASSERT
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//tag",
+		Columns: []Column{
+			{Header: "tag", ValuePath: ".", Type: "string"},
+		},
+	}
+	assert.Equal(t, expect, result)
+
+	// 生成したマッピングで変換でき、XMLに戻せる
+	outputPath := filepath.Join(temp, "output.csv")
+	require.NoError(t, convertFile([]string{inputPath}, result, outputPath, Format{}, false))
+	assert.Equal(t, joinRows("tag", "a", "b"), readString(t, outputPath))
+
+	reversed := new(bytes.Buffer)
+	csvFile, err := os.Open(outputPath)
+	require.NoError(t, err)
+	defer csvFile.Close()
+	require.NoError(t, reverseConvert(csvFile, result, reversed, ',', "tags"))
+	assert.Equal(t, xml.Header+"<tags>\n  <tag>a</tag>\n  <tag>b</tag>\n</tags>\n", reversed.String())
+}
+
+func TestXSDMapping_CyclicExtension(t *testing.T) {
+
+	// ARRANGE
+	temp := t.TempDir()
+
+	schemaPath := createFile(t, temp, "schema.xsd", `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:complexType name="a">
+    <xs:complexContent>
+      <xs:extension base="b">
+        <xs:sequence>
+          <xs:element name="x" type="xs:string"/>
+        </xs:sequence>
+        <xs:attribute name="ax" type="xs:string"/>
+      </xs:extension>
+    </xs:complexContent>
+  </xs:complexType>
+  <xs:complexType name="b">
+    <xs:complexContent>
+      <xs:extension base="a">
+        <xs:sequence>
+          <xs:element name="y" type="xs:string"/>
+        </xs:sequence>
+        <xs:attribute name="bx" type="xs:string"/>
+      </xs:extension>
+    </xs:complexContent>
+  </xs:complexType>
+  <xs:element name="list">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="item" type="a" maxOccurs="unbounded"/>
+      </xs:sequence>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`)
+
+	schema, err := loadXSD(schemaPath)
+	require.NoError(t, err)
+
+	// ACT
+	result, err := schema.mapping("")
+
+	// ASSERT
+	// 循環する基底型は一度だけたどる
+	require.NoError(t, err)
+
+	expect := &Mapping{
+		RowsPath: "//item",
+		Columns: []Column{
+			{Header: "bx", ValuePath: "/@bx", Type: "string"},
+			{Header: "ax", ValuePath: "/@ax", Type: "string"},
+			{Header: "y", ValuePath: "/y", Type: "string"},
+			{Header: "x", ValuePath: "/x", Type: "string"},
+		},
+	}
+	assert.Equal(t, expect, result)
+
+	// スキーマでの検証も終了する
+	violations, _, err := newSchemaValidator(schema).validate(strings.NewReader(`<list><item ax="1" bx="2"><y>b</y><x>a</x></item></list>`))
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+}